@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/kalexmills/crafting-interpreters-go/lox"
+)
+
+func main() {
+	trace := flag.Bool("trace", false, "print the stack and each instruction as it is executed")
+	printCode := flag.Bool("print-code", false, "print the disassembly of each compiled function")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: clox [--trace] [--print-code] [path]\n")
+	}
+	flag.Parse()
+
+	// N.B. the REPL and the input() native share one reader, so that neither buffers away lines meant for the other.
+	stdin := bufio.NewReader(os.Stdin)
+	opts := []lox.Option{
+		lox.WithInput(stdin),
+		lox.WithStdout(os.Stdout),
+		lox.WithStderr(os.Stderr),
+		lox.WithTrace(os.Stdout),
+	}
+	if *trace {
+		opts = append(opts, lox.WithTraceExecution())
+	}
+	if *printCode {
+		opts = append(opts, lox.WithPrintCode())
+	}
+	vm := lox.NewVM(opts...)
+
+	if flag.NArg() == 0 {
+		repl(vm, stdin)
+	} else if flag.NArg() == 1 {
+		runFile(vm, flag.Arg(0))
+	} else {
+		flag.Usage()
+		os.Exit(64)
+	}
+}
+
+func repl(vm *lox.VM, stdin *bufio.Reader) {
+	for {
+		fmt.Printf("> ")
+		line, err := stdin.ReadString('\n')
+		if err == io.EOF {
+			fmt.Println()
+			os.Exit(0)
+		}
+		if err != nil {
+			fmt.Printf("could not read from stdin: %v", err)
+			os.Exit(1)
+		}
+		fmt.Println()
+		vm.Interpret(line) // N.B. errors are reported to stderr by the VM
+	}
+}
+
+func runFile(vm *lox.VM, path string) {
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Printf("could not read file %s: %v", path, err)
+		os.Exit(1)
+	}
+	err = vm.InterpretFile(path, string(source))
+	if errors.Is(err, lox.ErrCompile) {
+		os.Exit(65)
+	}
+	if errors.Is(err, lox.ErrRuntime) {
+		os.Exit(70)
+	}
+}
@@ -0,0 +1,216 @@
+package lox
+
+import (
+	"fmt"
+	"sort"
+)
+
+const ( // N.B. these op-codes will not match those in the book (yet) at the commit where the list is complete it will be reordered.
+	OP_RETURN byte = iota
+	OP_CONSTANT
+	OP_NIL
+	OP_FALSE
+	OP_TRUE
+	OP_EQUAL
+	OP_GREATER
+	OP_LESS
+	OP_ADD
+	OP_SUBTRACT
+	OP_MULTIPLY
+	OP_DIVIDE
+	OP_NOT
+	OP_NEGATE
+	OP_PRINT
+	OP_POP
+	OP_DEFINE_GLOBAL
+	OP_GET_GLOBAL
+	OP_SET_GLOBAL
+	OP_GET_LOCAL
+	OP_SET_LOCAL
+	OP_JUMP
+	OP_JUMP_IF_FALSE
+	OP_LOOP
+	OP_CALL
+	OP_CLOSURE
+	OP_GET_UPVALUE
+	OP_SET_UPVALUE
+	OP_CLOSE_UPVALUE
+	OP_CLASS
+	OP_GET_PROPERTY
+	OP_SET_PROPERTY
+	OP_METHOD
+	OP_INHERIT
+	OP_GET_SUPER
+	OP_CONSTANT_LONG
+	OP_DEFINE_GLOBAL_LONG
+	OP_GET_GLOBAL_LONG
+	OP_SET_GLOBAL_LONG
+	OP_CLOSURE_LONG
+	OP_CLASS_LONG
+	OP_GET_PROPERTY_LONG
+	OP_SET_PROPERTY_LONG
+	OP_METHOD_LONG
+	OP_GET_SUPER_LONG
+	OP_NOT_EQUAL
+	OP_GREATER_EQUAL
+	OP_LESS_EQUAL
+)
+
+// uint24Count is the number of constants addressable by the 24-bit operand of a _LONG instruction.
+const uint24Count = 1 << 24
+
+// longConstantOp returns the _LONG variant of an instruction which takes an 8-bit constant index.
+func longConstantOp(op byte) byte {
+	switch op {
+	case OP_CONSTANT:
+		return OP_CONSTANT_LONG
+	case OP_DEFINE_GLOBAL:
+		return OP_DEFINE_GLOBAL_LONG
+	case OP_GET_GLOBAL:
+		return OP_GET_GLOBAL_LONG
+	case OP_SET_GLOBAL:
+		return OP_SET_GLOBAL_LONG
+	case OP_CLOSURE:
+		return OP_CLOSURE_LONG
+	case OP_CLASS:
+		return OP_CLASS_LONG
+	case OP_GET_PROPERTY:
+		return OP_GET_PROPERTY_LONG
+	case OP_SET_PROPERTY:
+		return OP_SET_PROPERTY_LONG
+	case OP_METHOD:
+		return OP_METHOD_LONG
+	case OP_GET_SUPER:
+		return OP_GET_SUPER_LONG
+	}
+	panic(fmt.Sprintf("opcode %d does not take a constant index", op))
+}
+
+// isLongConstantOp returns true if op takes a 24-bit constant index rather than an 8-bit one.
+func isLongConstantOp(op byte) bool {
+	switch op {
+	case OP_CONSTANT_LONG, OP_DEFINE_GLOBAL_LONG, OP_GET_GLOBAL_LONG, OP_SET_GLOBAL_LONG, OP_CLOSURE_LONG,
+		OP_CLASS_LONG, OP_GET_PROPERTY_LONG, OP_SET_PROPERTY_LONG, OP_METHOD_LONG, OP_GET_SUPER_LONG:
+		return true
+	}
+	return false
+}
+
+type Chunk struct {
+	// N.B. the dynamic array implementation in go handles all the features mentioned in the book.
+	Code      []byte
+	lines     []lineRun // N.B. run-length encoded; use GetLine to look up the line of an offset
+	spans     spanTable // N.B. delta encoded; use GetSpan to look up a span
+	constants valueArray
+	file      string // the name of the source file; may be empty
+	source    string // the source the chunk was compiled from; may be empty
+}
+
+// Span is the range of source from which an instruction was compiled.
+type Span struct {
+	Start  int // byte offset into the source
+	Length int // N.B. zero if the instruction has no source, e.g. in a chunk built by hand
+}
+
+func (c Chunk) Count() int {
+	return len(c.Code)
+}
+
+func (c *Chunk) AddConstant(v Value) int {
+	c.constants.writeValue(v)
+	return c.constants.count() - 1
+}
+
+// lineRun records that the bytecode starting at offset, up to the start of the next run, was compiled from line.
+type lineRun struct {
+	offset int
+	line   int
+}
+
+func (c *Chunk) Write(b byte, line int) {
+	c.WriteSpan(b, line, Span{})
+}
+
+// WriteSpan is like Write, but also records the span of source from which b was compiled.
+func (c *Chunk) WriteSpan(b byte, line int, span Span) {
+	c.Code = append(c.Code, b)
+	if n := len(c.lines); n == 0 || c.lines[n-1].line != line {
+		c.lines = append(c.lines, lineRun{offset: len(c.Code) - 1, line: line})
+	}
+	c.spans.add(len(c.Code)-1, span)
+}
+
+// GetLine returns the source line from which the byte at offset was compiled, or 0 if offset is out of range.
+func (c *Chunk) GetLine(offset int) int {
+	if offset < 0 || offset >= len(c.Code) {
+		return 0
+	}
+	run := sort.Search(len(c.lines), func(i int) bool { return c.lines[i].offset > offset }) - 1
+	return c.lines[run].line
+}
+
+// GetSpan returns the span of source from which the byte at offset was compiled, or the zero Span if offset is out
+// of range.
+func (c *Chunk) GetSpan(offset int) Span {
+	if offset < 0 || offset >= len(c.Code) {
+		return Span{}
+	}
+	return c.spans.get(offset)
+}
+
+// truncate discards the bytecode from offset onward, along with its line and span info.
+func (c *Chunk) truncate(offset int) {
+	c.Code = c.Code[:offset]
+	for n := len(c.lines); n > 0 && c.lines[n-1].offset >= offset; n-- {
+		c.lines = c.lines[:n-1]
+	}
+	c.spans.truncate(offset)
+}
+
+// snippet returns the source line of the byte at offset with its span marked, or nil if it has no source.
+func (c *Chunk) snippet(offset int) *Snippet {
+	span := c.GetSpan(offset)
+	if c.source == "" || span.Length == 0 {
+		return nil
+	}
+	return newSnippet(c.source, span.Start, span.Length)
+}
+
+// instructionLength returns the length in bytes of the instruction at offset, including its operands.
+func instructionLength(chunk *Chunk, offset int) int {
+	switch chunk.Code[offset] {
+	case OP_CONSTANT, OP_DEFINE_GLOBAL, OP_GET_GLOBAL, OP_SET_GLOBAL, OP_GET_LOCAL, OP_SET_LOCAL, OP_CALL,
+		OP_GET_UPVALUE, OP_SET_UPVALUE, OP_CLASS, OP_GET_PROPERTY, OP_SET_PROPERTY, OP_METHOD, OP_GET_SUPER:
+		return 2
+	case OP_JUMP, OP_JUMP_IF_FALSE, OP_LOOP:
+		return 3
+	case OP_CONSTANT_LONG, OP_DEFINE_GLOBAL_LONG, OP_GET_GLOBAL_LONG, OP_SET_GLOBAL_LONG, OP_CLASS_LONG,
+		OP_GET_PROPERTY_LONG, OP_SET_PROPERTY_LONG, OP_METHOD_LONG, OP_GET_SUPER_LONG:
+		return 4
+	case OP_CLOSURE:
+		function := asFunction(chunk.constants.values[chunk.Code[offset+1]])
+		return 2 + 2*function.upvalueCount
+	case OP_CLOSURE_LONG:
+		function := asFunction(chunk.constants.values[readUint24(chunk.Code, offset+1)])
+		return 4 + 2*function.upvalueCount
+	default:
+		return 1
+	}
+}
+
+// instructionAt returns the offset of the instruction which ends just before end.
+func instructionAt(chunk *Chunk, end int) int {
+	offset := 0
+	for {
+		next := offset + instructionLength(chunk, offset)
+		if next >= end {
+			return offset
+		}
+		offset = next
+	}
+}
+
+// readUint24 decodes the big-endian 24-bit operand which starts at offset.
+func readUint24(code []byte, offset int) int {
+	return int(code[offset])<<16 | int(code[offset+1])<<8 | int(code[offset+2])
+}
@@ -0,0 +1,165 @@
+package lox
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestGetLine(t *testing.T) {
+	var chunk Chunk
+	for _, line := range []int{1, 1, 1, 2, 4, 4, 1} {
+		chunk.Write(OP_NIL, line)
+	}
+	if len(chunk.lines) != 4 {
+		t.Errorf("len(lines) = %d, want 4 runs", len(chunk.lines))
+	}
+	tests := []struct {
+		offset int
+		line   int
+	}{
+		{0, 1},
+		{2, 1}, // last byte of the first run
+		{3, 2}, // a run of length one
+		{4, 4}, // first byte of a run
+		{5, 4},
+		{6, 1}, // a line seen earlier starts a new run
+		{-1, 0},
+		{7, 0},
+		{100, 0},
+	}
+	for _, test := range tests {
+		if got := chunk.GetLine(test.offset); got != test.line {
+			t.Errorf("GetLine(%d) = %d, want %d", test.offset, got, test.line)
+		}
+	}
+}
+
+func TestGetLineEmptyChunk(t *testing.T) {
+	var chunk Chunk
+	if got := chunk.GetLine(0); got != 0 {
+		t.Errorf("GetLine(0) of an empty chunk = %d, want 0", got)
+	}
+}
+
+func TestGetLineAfterTruncate(t *testing.T) {
+	var chunk Chunk
+	for _, line := range []int{1, 2, 2, 3} {
+		chunk.Write(OP_NIL, line)
+	}
+	chunk.truncate(2)
+	chunk.Write(OP_POP, 5)
+	for offset, want := range []int{1, 2, 5} {
+		if got := chunk.GetLine(offset); got != want {
+			t.Errorf("GetLine(%d) = %d after truncate, want %d", offset, got, want)
+		}
+	}
+	if got := chunk.GetLine(3); got != 0 {
+		t.Errorf("GetLine(3) = %d after truncate, want 0", got)
+	}
+}
+
+func TestGetSpan(t *testing.T) {
+	var chunk Chunk
+	spans := []Span{{0, 3}, {0, 3}, {4, 1}, {}, {1 << 20, 7}}
+	for _, span := range spans {
+		chunk.WriteSpan(OP_NIL, 1, span)
+	}
+	if chunk.spans.count != 4 {
+		t.Errorf("spans.count = %d, want 4 runs", chunk.spans.count)
+	}
+	for offset, want := range spans {
+		if got := chunk.GetSpan(offset); got != want {
+			t.Errorf("GetSpan(%d) = %v, want %v", offset, got, want)
+		}
+	}
+	for _, offset := range []int{-1, len(spans)} {
+		if got := chunk.GetSpan(offset); got != (Span{}) {
+			t.Errorf("GetSpan(%d) = %v, want the zero Span", offset, got)
+		}
+	}
+}
+
+// manySpans returns n spans which cross several checkpoints of the span table, with starts which move both forward and
+// back, and with runs of repeated spans.
+func manySpans(n int) []Span {
+	spans := make([]Span, n)
+	for i := range spans {
+		spans[i] = Span{Start: 1000 + (i/3)*7 - (i%5)*40, Length: i % 9}
+	}
+	return spans
+}
+
+func TestGetSpanAcrossCheckpoints(t *testing.T) {
+	var chunk Chunk
+	spans := manySpans(10 * spanCheckpointInterval)
+	for _, span := range spans {
+		chunk.WriteSpan(OP_NIL, 1, span)
+	}
+	if len(chunk.spans.checkpoints) < 2 {
+		t.Fatalf("spans have %d checkpoints, want several", len(chunk.spans.checkpoints))
+	}
+	for offset, want := range spans {
+		if got := chunk.GetSpan(offset); got != want {
+			t.Errorf("GetSpan(%d) = %v, want %v", offset, got, want)
+		}
+	}
+	cursor := newSpanCursor(&chunk.spans)
+	for offset, want := range spans {
+		if got := cursor.at(offset); got != want {
+			t.Errorf("cursor.at(%d) = %v, want %v", offset, got, want)
+		}
+	}
+}
+
+func TestGetSpanAfterTruncate(t *testing.T) {
+	spans := manySpans(4 * spanCheckpointInterval)
+	for _, cut := range []int{0, 1, spanCheckpointInterval - 1, spanCheckpointInterval, 2*spanCheckpointInterval + 5} {
+		var chunk Chunk
+		for _, span := range spans {
+			chunk.WriteSpan(OP_NIL, 1, span)
+		}
+		chunk.truncate(cut)
+		// N.B. the span written after the cut is the one just before it, so it must not be merged into a discarded run
+		after := Span{Start: 3, Length: 2}
+		if cut > 0 {
+			after = spans[cut-1]
+		}
+		chunk.WriteSpan(OP_POP, 1, after)
+		chunk.WriteSpan(OP_POP, 1, Span{Start: 1, Length: 1})
+		want := append(append([]Span{}, spans[:cut]...), after, Span{Start: 1, Length: 1})
+		for offset := range want {
+			if got := chunk.GetSpan(offset); got != want[offset] {
+				t.Errorf("truncate(%d): GetSpan(%d) = %v, want %v", cut, offset, got, want[offset])
+			}
+		}
+	}
+}
+
+// largeScript returns a script of n statements, each on its own line.
+func largeScript(n int) string {
+	var sb strings.Builder
+	sb.WriteString("var x = 0;\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "x = x + %d * (x - 1);\n", i%100)
+	}
+	return sb.String()
+}
+
+// BenchmarkCompileLarge reports the size of the line and span tables of a large script. The line table is also
+// reported as it would be with one int per byte of bytecode.
+func BenchmarkCompileLarge(b *testing.B) {
+	source := largeScript(20000)
+	b.ReportAllocs()
+	var chunk *Chunk
+	for i := 0; i < b.N; i++ {
+		var err error
+		if chunk, err = Compile(source); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(chunk.lines))*float64(unsafe.Sizeof(lineRun{})), "line-bytes")
+	b.ReportMetric(float64(chunk.Count())*float64(unsafe.Sizeof(int(0))), "unencoded-line-bytes")
+	b.ReportMetric(float64(chunk.spans.size()), "span-bytes")
+}
@@ -0,0 +1,1087 @@
+package lox
+
+import (
+	"io"
+	"math"
+	"strconv"
+)
+
+// Compile compiles source into the chunk for a top-level script. If compilation fails, the error is a CompileErrors
+// holding every error found.
+func Compile(source string) (*Chunk, error) {
+	return CompileFile("", source)
+}
+
+// CompileFile is like Compile, but records the name of the file source was read from for use in runtime errors.
+func CompileFile(file, source string) (*Chunk, error) {
+	function, err := compile(file, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &function.chunk, nil
+}
+
+// compile compiles source into the function for the top-level script. The code for each function is disassembled to
+// codeWriter, if it is non-nil.
+func compile(file, source string, codeWriter io.Writer) (*ObjFunction, error) {
+	p := &parser{file: file, codeWriter: codeWriter}
+	initScanner(&p.scanner, source)
+	var c compiler
+	p.initCompiler(&c, typeScript)
+	p.advanceParser()
+	for !p.matchToken(tokenEOF) {
+		p.declaration()
+	}
+	function := p.endCompiler()
+	if p.hadError {
+		return nil, p.errors
+	}
+	return function, nil
+}
+
+// parser holds all the state of a single compilation. N.B. the book keeps this, the scanner and the current compiler
+// in globals; here each call to compile gets its own, so compilations can run concurrently.
+type parser struct {
+	current   token
+	previous  token
+	hadError  bool
+	panicMode bool
+
+	errors        CompileErrors
+	file          string
+	codeWriter    io.Writer
+	scanner       scanner
+	compiler      *compiler
+	classCompiler *classCompiler
+}
+
+const uint8Count = 256
+
+type functionType uint8
+
+const (
+	typeFunction functionType = iota
+	typeInitializer
+	typeMethod
+	typeScript
+)
+
+type compiler struct {
+	enclosing *compiler
+	function  *ObjFunction
+	fnType    functionType
+
+	locals     [uint8Count]local
+	localCount int
+	upvalues   [uint8Count]upvalue
+	scopeDepth int
+
+	lastConstant constantLoad // N.B. the most recent constant load, which may be folded into an operator applied to it
+	jumpTarget   int          // the greatest offset targeted by a forward jump so far
+}
+
+// constantLoad records an instruction which loads a constant, so that operators applied to it can be folded.
+type constantLoad struct {
+	start, end int // the offset of the instruction and of the byte following it
+	pool       int // the size of the constant pool before the instruction was emitted
+	value      Value
+}
+
+type local struct {
+	name       token
+	depth      int // N.B. -1 marks a local that is declared but not yet initialized
+	isCaptured bool
+}
+
+type upvalue struct {
+	index   byte
+	isLocal bool
+}
+
+type classCompiler struct {
+	enclosing     *classCompiler
+	hasSuperclass bool
+}
+
+func (p *parser) initCompiler(c *compiler, fnType functionType) {
+	c.enclosing = p.compiler
+	c.function = newObjFunction()
+	c.function.chunk.file = p.file
+	c.function.chunk.source = p.scanner.source
+	c.fnType = fnType
+	c.localCount = 0
+	c.scopeDepth = 0
+	c.lastConstant = constantLoad{start: -1, end: -1}
+	p.compiler = c
+	if fnType != typeScript {
+		p.compiler.function.name = newObjString((*p.previous.source)[p.previous.start : p.previous.start+p.previous.length])
+	}
+
+	// the VM uses stack slot zero for the function being called
+	local := &p.compiler.locals[p.compiler.localCount]
+	p.compiler.localCount++
+	local.depth = 0
+	local.isCaptured = false
+	if fnType != typeFunction {
+		local.name = syntheticToken("this")
+	} else {
+		local.name = token{source: new(string)}
+	}
+}
+
+type precedence uint8
+
+const (
+	precNone precedence = iota
+	precAssignment
+	precOr
+	precAnd
+	precEquality
+	precComparison
+	precTerm
+	precFactor
+	precUnary
+	precCall
+	precPrimary
+)
+
+type parseRule struct {
+	prefix     parseFn
+	infix      parseFn
+	precedence precedence
+}
+
+type parseFn = func(p *parser, canAssign bool)
+
+func (p *parser) consume(typ tokenType, msg string) {
+	if p.current.typ == typ {
+		p.advanceParser()
+		return
+	}
+	p.errorAtCurrent(msg)
+}
+
+func (p *parser) check(typ tokenType) bool {
+	return p.current.typ == typ
+}
+
+func (p *parser) matchToken(typ tokenType) bool {
+	if !p.check(typ) {
+		return false
+	}
+	p.advanceParser()
+	return true
+}
+
+func (p *parser) advanceParser() {
+	p.previous = p.current
+	for {
+		p.current = p.scanner.scanToken()
+		if p.current.typ != tokenError {
+			break
+		}
+		p.errorAtCurrent(*p.current.source)
+	}
+}
+
+func (p *parser) errorAtCurrent(msg string) {
+	p.errorAt(&p.current, msg)
+}
+
+func (p *parser) errorRpt(msg string) {
+	p.errorAt(&p.previous, msg)
+}
+
+func (p *parser) errorAt(tok *token, msg string) {
+	if p.panicMode {
+		return
+	}
+	p.panicMode = true
+	err := &CompileError{Line: tok.line, Column: tok.column, Message: msg, tokenType: tok.typ}
+	switch tok.typ {
+	case tokenEOF:
+	case tokenError:
+		// N.B. an error token's source is its message, so locate the rejected text using the scanner instead
+		err.Snippet = newSnippet(p.scanner.source, p.scanner.start, p.scanner.current-p.scanner.start)
+	default:
+		err.Lexeme = (*tok.source)[tok.start : tok.start+tok.length]
+		err.Snippet = newSnippet(*tok.source, tok.start, tok.length)
+	}
+	p.errors = append(p.errors, err)
+	p.hadError = true
+}
+
+func (p *parser) expression() {
+	p.parsePrecedence(precAssignment)
+}
+
+func (p *parser) declaration() {
+	if p.matchToken(tokenClass) {
+		p.classDeclaration()
+	} else if p.matchToken(tokenFun) {
+		p.funDeclaration()
+	} else if p.matchToken(tokenVar) {
+		p.varDeclaration()
+	} else {
+		p.statement()
+	}
+	if p.panicMode {
+		p.synchronize()
+	}
+}
+
+func (p *parser) classDeclaration() {
+	p.consume(tokenIdentifier, "Expect class name.")
+	className := p.previous
+	nameConstant := p.identifierConstant(&p.previous)
+	p.declareVariable()
+
+	p.emitConstantOp(OP_CLASS, nameConstant)
+	p.defineVariable(nameConstant)
+
+	classCompiler := classCompiler{enclosing: p.classCompiler}
+	p.classCompiler = &classCompiler
+
+	if p.matchToken(tokenLess) {
+		p.consume(tokenIdentifier, "Expect superclass name.")
+		p.compileVariable(false)
+		if identifiersEqual(&className, &p.previous) {
+			p.errorRpt("A class can't inherit from itself.")
+		}
+
+		// N.B. each class gets its own scope holding 'super', so closures over it see the right superclass
+		p.beginScope()
+		p.addLocal(syntheticToken("super"))
+		p.defineVariable(0)
+
+		p.namedVariable(className, false)
+		p.emitByte(OP_INHERIT)
+		classCompiler.hasSuperclass = true
+	}
+
+	p.namedVariable(className, false) // load the class so methods can be bound to it
+	p.consume(tokenLeftBrace, "Expect '{' before class body.")
+	for !p.check(tokenRightBrace) && !p.check(tokenEOF) {
+		p.method()
+	}
+	p.consume(tokenRightBrace, "Expect '}' after class body.")
+	p.emitByte(OP_POP)
+
+	if classCompiler.hasSuperclass {
+		p.endScope()
+	}
+	p.classCompiler = p.classCompiler.enclosing
+}
+
+func (p *parser) method() {
+	p.consume(tokenIdentifier, "Expect method name.")
+	constant := p.identifierConstant(&p.previous)
+
+	fnType := typeMethod
+	if p.previous.length == 4 && (*p.previous.source)[p.previous.start:p.previous.start+4] == "init" {
+		fnType = typeInitializer
+	}
+	p.function(fnType)
+	p.emitConstantOp(OP_METHOD, constant)
+}
+
+func (p *parser) funDeclaration() {
+	global := p.parseVariable("Expect function name.")
+	p.markInitialized() // N.B. a function may refer to itself, so it's initialized before its body is compiled
+	p.function(typeFunction)
+	p.defineVariable(global)
+}
+
+func (p *parser) function(fnType functionType) {
+	var c compiler
+	p.initCompiler(&c, fnType)
+	p.beginScope() // N.B. never ended; p.endCompiler() discards the whole frame
+
+	p.consume(tokenLeftParen, "Expect '(' after function name.")
+	if !p.check(tokenRightParen) {
+		for {
+			p.compiler.function.arity++
+			if p.compiler.function.arity > 255 {
+				p.errorAtCurrent("Can't have more than 255 parameters.")
+			}
+			constant := p.parseVariable("Expect parameter name.")
+			p.defineVariable(constant)
+			if !p.matchToken(tokenComma) {
+				break
+			}
+		}
+	}
+	p.consume(tokenRightParen, "Expect ')' after parameters.")
+	p.consume(tokenLeftBrace, "Expect '{' before function body.")
+	p.block()
+
+	function := p.endCompiler()
+	p.emitConstantOp(OP_CLOSURE, p.makeConstant(ObjVal(function)))
+
+	for i := 0; i < function.upvalueCount; i++ {
+		if c.upvalues[i].isLocal {
+			p.emitByte(1)
+		} else {
+			p.emitByte(0)
+		}
+		p.emitByte(c.upvalues[i].index)
+	}
+}
+
+func (p *parser) varDeclaration() {
+	global := p.parseVariable("Expect variable name.")
+	if p.matchToken(tokenEqual) {
+		p.expression()
+	} else {
+		p.emitByte(OP_NIL)
+	}
+	p.consume(tokenSemicolon, "Expect ';' after variable declaration.")
+	p.defineVariable(global)
+}
+
+func (p *parser) statement() {
+	if p.matchToken(tokenPrint) {
+		p.printStatement()
+	} else if p.matchToken(tokenFor) {
+		p.forStatement()
+	} else if p.matchToken(tokenIf) {
+		p.ifStatement()
+	} else if p.matchToken(tokenReturn) {
+		p.returnStatement()
+	} else if p.matchToken(tokenWhile) {
+		p.whileStatement()
+	} else if p.matchToken(tokenLeftBrace) {
+		p.beginScope()
+		p.block()
+		p.endScope()
+	} else {
+		p.expressionStatement()
+	}
+}
+
+func (p *parser) block() {
+	for !p.check(tokenRightBrace) && !p.check(tokenEOF) {
+		p.declaration()
+	}
+	p.consume(tokenRightBrace, "Expect '}' after block.")
+}
+
+func (p *parser) beginScope() {
+	p.compiler.scopeDepth++
+}
+
+func (p *parser) endScope() {
+	p.compiler.scopeDepth--
+	for p.compiler.localCount > 0 && p.compiler.locals[p.compiler.localCount-1].depth > p.compiler.scopeDepth {
+		if p.compiler.locals[p.compiler.localCount-1].isCaptured {
+			p.emitByte(OP_CLOSE_UPVALUE)
+		} else {
+			p.emitByte(OP_POP)
+		}
+		p.compiler.localCount--
+	}
+}
+
+func (p *parser) printStatement() {
+	p.expression()
+	p.consume(tokenSemicolon, "Expect ';' after value.")
+	p.emitByte(OP_PRINT)
+}
+
+func (p *parser) ifStatement() {
+	p.consume(tokenLeftParen, "Expect '(' after 'if'.")
+	p.expression()
+	p.consume(tokenRightParen, "Expect ')' after condition.")
+
+	thenJump := p.emitJump(OP_JUMP_IF_FALSE)
+	p.emitByte(OP_POP)
+	p.statement()
+	elseJump := p.emitJump(OP_JUMP)
+
+	p.patchJump(thenJump)
+	p.emitByte(OP_POP)
+	if p.matchToken(tokenElse) {
+		p.statement()
+	}
+	p.patchJump(elseJump)
+}
+
+func (p *parser) returnStatement() {
+	if p.compiler.fnType == typeScript {
+		p.errorRpt("Can't return from top-level code.")
+	}
+	if p.matchToken(tokenSemicolon) {
+		p.emitReturn()
+	} else {
+		if p.compiler.fnType == typeInitializer {
+			p.errorRpt("Can't return a value from an initializer.")
+		}
+		p.expression()
+		p.consume(tokenSemicolon, "Expect ';' after return value.")
+		p.emitByte(OP_RETURN)
+	}
+}
+
+func (p *parser) whileStatement() {
+	loopStart := p.currentChunk().Count()
+	p.consume(tokenLeftParen, "Expect '(' after 'while'.")
+	p.expression()
+	p.consume(tokenRightParen, "Expect ')' after condition.")
+
+	exitJump := p.emitJump(OP_JUMP_IF_FALSE)
+	p.emitByte(OP_POP)
+	p.statement()
+	p.emitLoop(loopStart)
+
+	p.patchJump(exitJump)
+	p.emitByte(OP_POP)
+}
+
+func (p *parser) forStatement() {
+	p.beginScope()
+	p.consume(tokenLeftParen, "Expect '(' after 'for'.")
+	if p.matchToken(tokenSemicolon) {
+		// no initializer
+	} else if p.matchToken(tokenVar) {
+		p.varDeclaration()
+	} else {
+		p.expressionStatement()
+	}
+
+	loopStart := p.currentChunk().Count()
+	exitJump := -1
+	if !p.matchToken(tokenSemicolon) {
+		p.expression()
+		p.consume(tokenSemicolon, "Expect ';' after loop condition.")
+
+		exitJump = p.emitJump(OP_JUMP_IF_FALSE)
+		p.emitByte(OP_POP)
+	}
+
+	if !p.matchToken(tokenRightParen) {
+		// N.B. the increment runs after the body, so jump over it and loop back to it from the end of the body
+		bodyJump := p.emitJump(OP_JUMP)
+		incrementStart := p.currentChunk().Count()
+		p.expression()
+		p.emitByte(OP_POP)
+		p.consume(tokenRightParen, "Expect ')' after for clauses.")
+
+		p.emitLoop(loopStart)
+		loopStart = incrementStart
+		p.patchJump(bodyJump)
+	}
+
+	p.statement()
+	p.emitLoop(loopStart)
+
+	if exitJump != -1 {
+		p.patchJump(exitJump)
+		p.emitByte(OP_POP)
+	}
+	p.endScope()
+}
+
+func (p *parser) expressionStatement() {
+	p.expression()
+	p.consume(tokenSemicolon, "Expect ';' after expression.")
+	p.emitByte(OP_POP)
+}
+
+// synchronize skips tokens until it reaches something that looks like a statement boundary.
+func (p *parser) synchronize() {
+	p.panicMode = false
+	for p.current.typ != tokenEOF {
+		if p.previous.typ == tokenSemicolon {
+			return
+		}
+		switch p.current.typ {
+		case tokenClass, tokenFun, tokenVar, tokenFor, tokenIf, tokenWhile, tokenPrint, tokenReturn:
+			return
+		}
+		p.advanceParser()
+	}
+}
+
+func (p *parser) parseVariable(errorMsg string) int {
+	p.consume(tokenIdentifier, errorMsg)
+
+	p.declareVariable()
+	if p.compiler.scopeDepth > 0 {
+		return 0
+	}
+	return p.identifierConstant(&p.previous)
+}
+
+func (p *parser) identifierConstant(name *token) int {
+	return p.makeConstant(ObjVal(newObjString((*name.source)[name.start : name.start+name.length])))
+}
+
+func identifiersEqual(a, b *token) bool {
+	return a.length == b.length && (*a.source)[a.start:a.start+a.length] == (*b.source)[b.start:b.start+b.length]
+}
+
+func (p *parser) resolveLocal(c *compiler, name *token) int {
+	for i := c.localCount - 1; i >= 0; i-- {
+		local := &c.locals[i]
+		if identifiersEqual(name, &local.name) {
+			if local.depth == -1 {
+				p.errorRpt("Can't read local variable in its own initializer.")
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *parser) addUpvalue(c *compiler, index byte, isLocal bool) int {
+	upvalueCount := c.function.upvalueCount
+
+	for i := 0; i < upvalueCount; i++ {
+		upvalue := &c.upvalues[i]
+		if upvalue.index == index && upvalue.isLocal == isLocal {
+			return i
+		}
+	}
+
+	if upvalueCount == uint8Count {
+		p.errorRpt("Too many closure variables in function.")
+		return 0
+	}
+
+	c.upvalues[upvalueCount].isLocal = isLocal
+	c.upvalues[upvalueCount].index = index
+	c.function.upvalueCount++
+	return upvalueCount
+}
+
+// resolveUpvalue looks for name in the enclosing functions, adding an upvalue to each function along the way.
+func (p *parser) resolveUpvalue(c *compiler, name *token) int {
+	if c.enclosing == nil {
+		return -1
+	}
+
+	local := p.resolveLocal(c.enclosing, name)
+	if local != -1 {
+		c.enclosing.locals[local].isCaptured = true
+		return p.addUpvalue(c, byte(local), true)
+	}
+
+	upvalue := p.resolveUpvalue(c.enclosing, name)
+	if upvalue != -1 {
+		return p.addUpvalue(c, byte(upvalue), false)
+	}
+	return -1
+}
+
+func (p *parser) addLocal(name token) {
+	if p.compiler.localCount == uint8Count {
+		p.errorRpt("Too many local variables in function.")
+		return
+	}
+	local := &p.compiler.locals[p.compiler.localCount]
+	p.compiler.localCount++
+	local.name = name
+	local.depth = -1
+	local.isCaptured = false
+}
+
+func (p *parser) declareVariable() {
+	if p.compiler.scopeDepth == 0 {
+		return
+	}
+	name := &p.previous
+	for i := p.compiler.localCount - 1; i >= 0; i-- {
+		local := &p.compiler.locals[i]
+		if local.depth != -1 && local.depth < p.compiler.scopeDepth {
+			break
+		}
+		if identifiersEqual(name, &local.name) {
+			p.errorRpt("Already a variable with this name in this scope.")
+		}
+	}
+	p.addLocal(*name)
+}
+
+func (p *parser) markInitialized() {
+	if p.compiler.scopeDepth == 0 {
+		return
+	}
+	p.compiler.locals[p.compiler.localCount-1].depth = p.compiler.scopeDepth
+}
+
+func (p *parser) defineVariable(global int) {
+	if p.compiler.scopeDepth > 0 {
+		p.markInitialized()
+		return
+	}
+	p.emitConstantOp(OP_DEFINE_GLOBAL, global)
+}
+
+func (p *parser) parsePrecedence(prec precedence) {
+	p.advanceParser()
+	prefixRule := rules[p.previous.typ].prefix
+	if prefixRule == nil {
+		p.errorRpt("expect expression.")
+		return
+	}
+	canAssign := prec <= precAssignment
+	prefixRule(p, canAssign)
+
+	for prec <= rules[p.current.typ].precedence {
+		p.advanceParser()
+		infixRule := rules[p.previous.typ].infix
+		infixRule(p, canAssign)
+	}
+
+	if canAssign && p.matchToken(tokenEqual) {
+		p.errorRpt("Invalid assignment target.")
+	}
+}
+
+func (p *parser) emitConstant(value Value) {
+	p.emitConstantAt(value, p.previous)
+}
+
+// emitConstantAt emits the instruction which loads value, attributed to token, and records it for constant folding.
+func (p *parser) emitConstantAt(value Value, token token) {
+	chunk := p.currentChunk()
+	load := constantLoad{start: chunk.Count(), pool: chunk.constants.count(), value: value}
+	switch {
+	case isNil(value):
+		p.emitByteAt(OP_NIL, token)
+	case isBool(value) && value.AsBoolean():
+		p.emitByteAt(OP_TRUE, token)
+	case isBool(value):
+		p.emitByteAt(OP_FALSE, token)
+	default:
+		p.emitConstantOpAt(OP_CONSTANT, p.makeConstant(value), token)
+	}
+	load.end = chunk.Count()
+	p.compiler.lastConstant = load
+}
+
+// trailingConstant returns the last constant load emitted, and whether it is the final instruction of the chunk. A
+// constant load which a jump lands after is not, since the expression it ends may not evaluate to the constant.
+func (p *parser) trailingConstant() (constantLoad, bool) {
+	load := p.compiler.lastConstant
+	return load, load.end == p.currentChunk().Count() && p.compiler.jumpTarget <= load.start
+}
+
+// discardConstants removes everything emitted since load, including constants, so a folded value can replace it.
+func (p *parser) discardConstants(load constantLoad) {
+	chunk := p.currentChunk()
+	chunk.truncate(load.start)
+	chunk.constants.values = chunk.constants.values[:load.pool]
+}
+
+// emitConstantOp emits op with the given constant index as its operand, switching to the _LONG variant of op when
+// the index does not fit in a single byte.
+func (p *parser) emitConstantOp(op byte, constant int) {
+	p.emitConstantOpAt(op, constant, p.previous)
+}
+
+func (p *parser) emitConstantOpAt(op byte, constant int, token token) {
+	if constant < uint8Count {
+		p.emitBytesAt(op, byte(constant), token)
+		return
+	}
+	p.emitByteAt(longConstantOp(op), token)
+	p.emitByteAt(byte(constant>>16), token)
+	p.emitByteAt(byte(constant>>8), token)
+	p.emitByteAt(byte(constant), token)
+}
+
+func (p *parser) makeConstant(value Value) int {
+	constant := p.currentChunk().AddConstant(value)
+	if constant >= uint24Count {
+		p.errorRpt("too many constants in one chunk.")
+		return 0
+	}
+	return constant
+}
+
+func (p *parser) currentChunk() *Chunk {
+	return &p.compiler.function.chunk
+}
+
+func (p *parser) emitByte(b byte) {
+	p.emitByteAt(b, p.previous)
+}
+
+// emitByteAt emits b, attributing it to the line and span of token rather than of the previous token.
+func (p *parser) emitByteAt(b byte, token token) {
+	p.currentChunk().WriteSpan(b, token.line, Span{Start: token.start, Length: token.length})
+}
+
+// emitJump emits a jump instruction with a placeholder operand and returns the offset of that operand.
+func (p *parser) emitJump(instruction byte) int {
+	p.emitByte(instruction)
+	p.emitByte(0xff)
+	p.emitByte(0xff)
+	return p.currentChunk().Count() - 2
+}
+
+func (p *parser) patchJump(offset int) {
+	// -2 to adjust for the bytecode for the jump offset itself
+	jump := p.currentChunk().Count() - offset - 2
+	if jump > math.MaxUint16 {
+		p.errorRpt("Too much code to jump over.")
+	}
+	p.compiler.jumpTarget = p.currentChunk().Count()
+	p.currentChunk().Code[offset] = byte((jump >> 8) & 0xff)
+	p.currentChunk().Code[offset+1] = byte(jump & 0xff)
+}
+
+func (p *parser) emitLoop(loopStart int) {
+	p.emitByte(OP_LOOP)
+
+	offset := p.currentChunk().Count() - loopStart + 2
+	if offset > math.MaxUint16 {
+		p.errorRpt("Loop body too large.")
+	}
+	p.emitByte(byte((offset >> 8) & 0xff))
+	p.emitByte(byte(offset & 0xff))
+}
+
+func (p *parser) emitReturn() {
+	if p.compiler.fnType == typeInitializer {
+		p.emitBytes(OP_GET_LOCAL, 0) // N.B. initializers implicitly return 'this'
+	} else {
+		p.emitByte(OP_NIL)
+	}
+	p.emitByte(OP_RETURN)
+}
+
+func (p *parser) emitBytes(b1, b2 byte) {
+	p.emitBytesAt(b1, b2, p.previous)
+}
+
+func (p *parser) emitBytesAt(b1, b2 byte, token token) {
+	p.emitByteAt(b1, token)
+	p.emitByteAt(b2, token)
+}
+
+func (p *parser) endCompiler() *ObjFunction {
+	p.emitReturn()
+	function := p.compiler.function
+	if !p.hadError {
+		optimize(p.currentChunk())
+	}
+	if p.codeWriter != nil {
+		if !p.hadError {
+			name := "<script>"
+			if function.name != nil {
+				name = function.name.value
+			}
+			DisassembleChunk(p.codeWriter, p.currentChunk(), name)
+		}
+	}
+	p.compiler = p.compiler.enclosing
+	return function
+}
+
+func (p *parser) compileBinary(canAssign bool) {
+	operator := p.previous
+	left, leftConstant := p.trailingConstant()
+	rule := rules[operator.typ]
+	p.parsePrecedence(precedence(rule.precedence + 1))
+
+	if right, ok := p.trailingConstant(); ok && leftConstant && right.start == left.end {
+		if value, ok := foldBinary(operator.typ, left.value, right.value); ok {
+			p.discardConstants(left)
+			p.emitConstantAt(value, operator)
+			return
+		}
+	}
+
+	switch operator.typ {
+	case tokenBangEqual:
+		p.emitByteAt(OP_NOT_EQUAL, operator)
+	case tokenEqualEqual:
+		p.emitByteAt(OP_EQUAL, operator)
+	case tokenGreater:
+		p.emitByteAt(OP_GREATER, operator)
+	case tokenGreaterEqual:
+		p.emitByteAt(OP_GREATER_EQUAL, operator)
+	case tokenLess:
+		p.emitByteAt(OP_LESS, operator)
+	case tokenLessEqual:
+		p.emitByteAt(OP_LESS_EQUAL, operator)
+	case tokenPlus:
+		p.emitByteAt(OP_ADD, operator)
+	case tokenMinus:
+		p.emitByteAt(OP_SUBTRACT, operator)
+	case tokenStar:
+		p.emitByteAt(OP_MULTIPLY, operator)
+	case tokenSlash:
+		p.emitByteAt(OP_DIVIDE, operator)
+	}
+}
+
+func (p *parser) compileCall(canAssign bool) {
+	paren := p.previous
+	argCount := p.argumentList()
+	p.emitBytesAt(OP_CALL, argCount, paren)
+}
+
+func (p *parser) argumentList() byte {
+	var argCount int
+	if !p.check(tokenRightParen) {
+		for {
+			p.expression()
+			if argCount == 255 {
+				p.errorRpt("Can't have more than 255 arguments.")
+			}
+			argCount++
+			if !p.matchToken(tokenComma) {
+				break
+			}
+		}
+	}
+	p.consume(tokenRightParen, "Expect ')' after arguments.")
+	return byte(argCount)
+}
+
+func (p *parser) compileDot(canAssign bool) {
+	p.consume(tokenIdentifier, "Expect property name after '.'.")
+	property := p.previous
+	name := p.identifierConstant(&property)
+
+	if canAssign && p.matchToken(tokenEqual) {
+		p.expression()
+		p.emitConstantOpAt(OP_SET_PROPERTY, name, property)
+	} else {
+		p.emitConstantOp(OP_GET_PROPERTY, name)
+	}
+}
+
+func (p *parser) compileGrouping(canAssign bool) {
+	p.expression()
+	p.consume(tokenRightParen, "Expect ')' after expression.")
+}
+
+func (p *parser) compileNumber(canAssign bool) {
+	// N.B. error from ParseFlot is safely ignored because our scanner correctly identifies valid input
+	value, _ := strconv.ParseFloat((*p.previous.source)[p.previous.start:p.previous.start+p.previous.length], 64)
+	p.emitConstant(NumberVal(value))
+}
+
+func (p *parser) compileString(canAssign bool) {
+	p.emitConstant(ObjVal(newObjString((*p.previous.source)[p.previous.start+1 : p.previous.start+1+p.previous.length-2])))
+}
+
+func (p *parser) compileVariable(canAssign bool) {
+	p.namedVariable(p.previous, canAssign)
+}
+
+func (p *parser) namedVariable(name token, canAssign bool) {
+	var getOp, setOp byte
+	arg := p.resolveLocal(p.compiler, &name)
+	if arg != -1 {
+		getOp, setOp = OP_GET_LOCAL, OP_SET_LOCAL
+	} else if arg = p.resolveUpvalue(p.compiler, &name); arg != -1 {
+		getOp, setOp = OP_GET_UPVALUE, OP_SET_UPVALUE
+	} else {
+		arg = p.identifierConstant(&name)
+		getOp, setOp = OP_GET_GLOBAL, OP_SET_GLOBAL
+	}
+
+	op, at := getOp, p.previous
+	if canAssign && p.matchToken(tokenEqual) {
+		p.expression()
+		op, at = setOp, name
+	}
+	if op == OP_GET_GLOBAL || op == OP_SET_GLOBAL {
+		p.emitConstantOpAt(op, arg, at) // N.B. globals are named by a constant index which may need a wide operand
+	} else {
+		p.emitBytesAt(op, byte(arg), at)
+	}
+}
+
+func (p *parser) compileAnd(canAssign bool) {
+	endJump := p.emitJump(OP_JUMP_IF_FALSE)
+	p.emitByte(OP_POP)
+	p.parsePrecedence(precAnd)
+	p.patchJump(endJump)
+}
+
+func (p *parser) compileOr(canAssign bool) {
+	elseJump := p.emitJump(OP_JUMP_IF_FALSE)
+	endJump := p.emitJump(OP_JUMP)
+
+	p.patchJump(elseJump)
+	p.emitByte(OP_POP)
+
+	p.parsePrecedence(precOr)
+	p.patchJump(endJump)
+}
+
+func (p *parser) compileSuper(canAssign bool) {
+	if p.classCompiler == nil {
+		p.errorRpt("Can't use 'super' outside of a class.")
+	} else if !p.classCompiler.hasSuperclass {
+		p.errorRpt("Can't use 'super' in a class with no superclass.")
+	}
+
+	p.consume(tokenDot, "Expect '.' after 'super'.")
+	p.consume(tokenIdentifier, "Expect superclass method name.")
+	name := p.identifierConstant(&p.previous)
+
+	p.namedVariable(syntheticToken("this"), false)
+	p.namedVariable(syntheticToken("super"), false)
+	p.emitConstantOp(OP_GET_SUPER, name)
+}
+
+func (p *parser) compileThis(canAssign bool) {
+	if p.classCompiler == nil {
+		p.errorRpt("Can't use 'this' outside of a class.")
+		return
+	}
+	p.compileVariable(false) // N.B. 'this' can't be assigned to
+}
+
+func syntheticToken(text string) token {
+	return token{typ: tokenIdentifier, start: 0, length: len(text), source: &text}
+}
+
+func (p *parser) compileUnary(canAssign bool) {
+	operator := p.previous
+	start := p.currentChunk().Count()
+
+	p.parsePrecedence(precUnary)
+
+	if operand, ok := p.trailingConstant(); ok && operand.start == start {
+		if value, ok := foldUnary(operator.typ, operand.value); ok {
+			p.discardConstants(operand)
+			p.emitConstantAt(value, operator)
+			return
+		}
+	}
+
+	switch operator.typ {
+	case tokenBang:
+		p.emitByteAt(OP_NOT, operator)
+	case tokenMinus:
+		p.emitByteAt(OP_NEGATE, operator)
+	default:
+		return
+	}
+}
+
+func (p *parser) compileLiteral(canAssign bool) {
+	switch p.previous.typ {
+	case tokenFalse:
+		p.emitConstant(BoolVal(false))
+	case tokenNil:
+		p.emitConstant(NilVal())
+	case tokenTrue:
+		p.emitConstant(BoolVal(true))
+	}
+}
+
+// foldBinary evaluates a binary operator applied to two constants the same way the VM would. It returns false if the
+// VM would raise an error instead, which is left for the VM to report.
+func foldBinary(operator tokenType, a, b Value) (Value, bool) {
+	switch operator {
+	case tokenBangEqual:
+		return BoolVal(!constantsEqual(a, b)), true
+	case tokenEqualEqual:
+		return BoolVal(constantsEqual(a, b)), true
+	case tokenPlus:
+		if isString(a) && isString(b) {
+			return ObjVal(newObjString(asString(a).value + asString(b).value)), true
+		}
+	}
+	if !isNumber(a) || !isNumber(b) {
+		return NilVal(), false
+	}
+	x, y := a.AsNumber(), b.AsNumber()
+	switch operator {
+	case tokenGreater:
+		return greater(x, y), true
+	case tokenGreaterEqual:
+		return greaterEqual(x, y), true
+	case tokenLess:
+		return less(x, y), true
+	case tokenLessEqual:
+		return lessEqual(x, y), true
+	case tokenPlus:
+		return add(x, y), true
+	case tokenMinus:
+		return subtract(x, y), true
+	case tokenStar:
+		return multiply(x, y), true
+	case tokenSlash:
+		return divide(x, y), true // N.B. division by zero gives an infinity or NaN, as it does at runtime
+	}
+	return NilVal(), false
+}
+
+// foldUnary evaluates a unary operator applied to a constant the same way the VM would, as foldBinary does.
+func foldUnary(operator tokenType, a Value) (Value, bool) {
+	switch operator {
+	case tokenBang:
+		return BoolVal(isFalsey(a)), true
+	case tokenMinus:
+		if isNumber(a) {
+			return NumberVal(-a.AsNumber()), true
+		}
+	}
+	return NilVal(), false
+}
+
+// constantsEqual is like valuesEqual, but compares strings by value, since constants are not interned until the chunk
+// is loaded into a VM.
+func constantsEqual(a, b Value) bool {
+	if isString(a) && isString(b) {
+		return asString(a).value == asString(b).value
+	}
+	return valuesEqual(a, b)
+}
+
+var rules map[tokenType]parseRule
+
+func init() {
+	rules = map[tokenType]parseRule{
+		tokenLeftParen:    {(*parser).compileGrouping, (*parser).compileCall, precCall},
+		tokenRightParen:   {nil, nil, precNone},
+		tokenLeftBrace:    {nil, nil, precNone},
+		tokenRightBrace:   {nil, nil, precNone},
+		tokenComma:        {nil, nil, precNone},
+		tokenDot:          {nil, (*parser).compileDot, precCall},
+		tokenMinus:        {(*parser).compileUnary, (*parser).compileBinary, precTerm},
+		tokenPlus:         {nil, (*parser).compileBinary, precTerm},
+		tokenSemicolon:    {nil, nil, precNone},
+		tokenSlash:        {nil, (*parser).compileBinary, precFactor},
+		tokenStar:         {nil, (*parser).compileBinary, precFactor},
+		tokenBang:         {(*parser).compileUnary, nil, precNone},
+		tokenBangEqual:    {nil, (*parser).compileBinary, precEquality},
+		tokenEqual:        {nil, nil, precNone},
+		tokenEqualEqual:   {nil, (*parser).compileBinary, precEquality},
+		tokenGreater:      {nil, (*parser).compileBinary, precComparison},
+		tokenGreaterEqual: {nil, (*parser).compileBinary, precComparison},
+		tokenLess:         {nil, (*parser).compileBinary, precComparison},
+		tokenLessEqual:    {nil, (*parser).compileBinary, precComparison},
+		tokenIdentifier:   {(*parser).compileVariable, nil, precNone},
+		tokenString:       {(*parser).compileString, nil, precNone},
+		tokenNumber:       {(*parser).compileNumber, nil, precNone},
+		tokenAnd:          {nil, (*parser).compileAnd, precAnd},
+		tokenClass:        {nil, nil, precNone},
+		tokenElse:         {nil, nil, precNone},
+		tokenFalse:        {(*parser).compileLiteral, nil, precNone},
+		tokenFor:          {nil, nil, precNone},
+		tokenFun:          {nil, nil, precNone},
+		tokenIf:           {nil, nil, precNone},
+		tokenNil:          {(*parser).compileLiteral, nil, precNone},
+		tokenOr:           {nil, (*parser).compileOr, precOr},
+		tokenPrint:        {nil, nil, precNone},
+		tokenReturn:       {nil, nil, precNone},
+		tokenSuper:        {(*parser).compileSuper, nil, precNone},
+		tokenThis:         {(*parser).compileThis, nil, precNone},
+		tokenTrue:         {(*parser).compileLiteral, nil, precNone},
+		tokenVar:          {nil, nil, precNone},
+		tokenWhile:        {nil, nil, precNone},
+		tokenError:        {nil, nil, precNone},
+		tokenEOF:          {nil, nil, precNone},
+	}
+}
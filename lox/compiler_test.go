@@ -0,0 +1,255 @@
+package lox
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// opcodes returns the opcode of each instruction in chunk, skipping their operands.
+func opcodes(chunk *Chunk) []byte {
+	var ops []byte
+	for offset := 0; offset < chunk.Count(); offset += instructionLength(chunk, offset) {
+		ops = append(ops, chunk.Code[offset])
+	}
+	return ops
+}
+
+// mustCompile compiles source, failing the test if it does not compile.
+func mustCompile(t *testing.T, source string) *Chunk {
+	t.Helper()
+	chunk, err := Compile(source)
+	if err != nil {
+		t.Fatalf("Compile(%q): %v", source, err)
+	}
+	return chunk
+}
+
+// expectOpcodes fails the test unless source compiles to exactly the instructions in want.
+func expectOpcodes(t *testing.T, source string, want ...byte) *Chunk {
+	t.Helper()
+	chunk := mustCompile(t, source)
+	if got := opcodes(chunk); !reflect.DeepEqual(got, want) {
+		t.Errorf("%q compiled to opcodes %v, want %v\n%s", source, got, want, listing(chunk))
+	}
+	return chunk
+}
+
+// listing returns the disassembly of chunk.
+func listing(chunk *Chunk) string {
+	var sb strings.Builder
+	DisassembleChunk(&sb, chunk, "script")
+	return sb.String()
+}
+
+// expectListing fails the test unless source compiles to a chunk whose disassembly is exactly want.
+func expectListing(t *testing.T, source, want string) *Chunk {
+	t.Helper()
+	chunk := mustCompile(t, source)
+	if got := listing(chunk); got != want {
+		t.Errorf("%q disassembled to\n%s\nwant\n%s", source, got, want)
+	}
+	return chunk
+}
+
+// expectFolded fails the test unless source compiles to exactly the same code, constants and lines as folded, which
+// is source with its constant expressions evaluated by hand.
+func expectFolded(t *testing.T, source, folded string) {
+	t.Helper()
+	if got, want := listing(mustCompile(t, source)), listing(mustCompile(t, folded)); got != want {
+		t.Errorf("%q disassembled to\n%s\nwant the same as %q\n%s", source, got, folded, want)
+	}
+}
+
+func TestFoldNestedExpression(t *testing.T) {
+	chunk := expectListing(t, "print -(1 + 2) * 3;", `== script ==
+0000    1 OP_CONSTANT         0 '-9'
+0002    | OP_PRINT
+0003    | OP_NIL
+0004    | OP_RETURN
+`)
+	if chunk.constants.count() != 1 {
+		t.Errorf("constant pool holds %d values, want only the folded one", chunk.constants.count())
+	}
+	expectFolded(t, "print -(1 + 2) * 3;", "print -9;")
+	expectFolded(t, `print "a" + "b";`, `print "ab";`)
+	expectFolded(t, "print !nil == (1 < 2);", "print true;")
+	expectFolded(t, "var x = 2; print -(1 + 2) * x;", "var x = 2; print -3 * x;")
+}
+
+func TestFoldDivisionByZero(t *testing.T) {
+	for source, want := range map[string]string{
+		"print 1 / 0;":  "+Inf",
+		"print -1 / 0;": "-Inf",
+		"print 0 / 0;":  "NaN",
+	} {
+		expectListing(t, source, `== script ==
+0000    1 OP_CONSTANT         0 '`+want+`'
+0002    | OP_PRINT
+0003    | OP_NIL
+0004    | OP_RETURN
+`)
+	}
+}
+
+func TestNoFoldAcrossLogicalOperators(t *testing.T) {
+	expectListing(t, "print 1 and 2;", `== script ==
+0000    1 OP_CONSTANT         0 '1'
+0002    | OP_JUMP_IF_FALSE    2 -> 8
+0005    | OP_POP
+0006    | OP_CONSTANT         1 '2'
+0008    | OP_PRINT
+0009    | OP_NIL
+0010    | OP_RETURN
+`)
+	expectListing(t, "print (1 or 2) + 3;", `== script ==
+0000    1 OP_CONSTANT         0 '1'
+0002    | OP_JUMP_IF_FALSE    2 -> 8
+0005    | OP_JUMP             5 -> 11
+0008    | OP_POP
+0009    | OP_CONSTANT         1 '2'
+0011    | OP_CONSTANT         2 '3'
+0013    | OP_ADD
+0014    | OP_PRINT
+0015    | OP_NIL
+0016    | OP_RETURN
+`)
+
+	// N.B. folding 2 + 3 would skip the addition whenever the left operand of 'or' is truthy
+	tests := map[string]string{
+		"print (1 or 2) + 3;":      "4\n",
+		"print (nil or 2) + 3;":    "5\n",
+		"print (true and 2) * 10;": "20\n",
+		"print !(nil and 2);":      "true\n",
+	}
+	for source, want := range tests {
+		if out, err := interpret(source); err != nil || out != want {
+			t.Errorf("%q printed %q, %v; want %q", source, out, err, want)
+		}
+	}
+}
+
+func TestNoFoldOfRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		source  string
+		listing string
+		message string
+	}{
+		{`print "a" + 1;`, `== script ==
+0000    1 OP_CONSTANT         0 'a'
+0002    | OP_CONSTANT         1 '1'
+0004    | OP_ADD
+0005    | OP_PRINT
+0006    | OP_NIL
+0007    | OP_RETURN
+`, "Operands must be two numbers or two strings."},
+		{"print -nil;", `== script ==
+0000    1 OP_NIL
+0001    | OP_NEGATE
+0002    | OP_PRINT
+0003    | OP_NIL
+0004    | OP_RETURN
+`, "Operand must be a number."},
+		{"print 1 < nil;", `== script ==
+0000    1 OP_CONSTANT         0 '1'
+0002    | OP_NIL
+0003    | OP_LESS
+0004    | OP_PRINT
+0005    | OP_NIL
+0006    | OP_RETURN
+`, "Operands must be numbers."},
+	}
+	for _, test := range tests {
+		expectListing(t, test.source, test.listing)
+		_, err := interpret(test.source)
+		if rerr, ok := err.(*RuntimeError); !ok || rerr.Message != test.message {
+			t.Errorf("%q failed with %v, want a runtime error %q", test.source, err, test.message)
+		}
+	}
+}
+
+func TestFoldKeepsOperatorPosition(t *testing.T) {
+	source := "print 1\n  + 2\n  * 3;"
+	// N.B. 2 * 3 folds first, then 1 + 6, so the constant takes the line of the '+'
+	chunk := expectListing(t, source, `== script ==
+0000    2 OP_CONSTANT         0 '7'
+0002    3 OP_PRINT
+0003    | OP_NIL
+0004    | OP_RETURN
+`)
+	if span, want := chunk.GetSpan(0), (Span{Start: strings.Index(source, "+"), Length: 1}); span != want {
+		t.Errorf("folded constant has span %v, want %v", span, want)
+	}
+	if span := chunk.GetSpan(1); span != chunk.GetSpan(0) {
+		t.Errorf("operand of folded constant has span %v, want %v", span, chunk.GetSpan(0))
+	}
+}
+
+// constantPadding returns n expression statements which each add a constant to the chunk they are compiled into. N.B.
+// the peephole pass removes their code, but not their constants.
+func constantPadding(n int) string {
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "%d;", i)
+	}
+	return sb.String()
+}
+
+// disassemble compiles source and returns the disassembly of every function in it.
+func disassemble(t *testing.T, source string) string {
+	t.Helper()
+	var sb strings.Builder
+	if _, err := compile("", source, &sb); err != nil {
+		t.Fatalf("compile(%q): %v", source, err)
+	}
+	return sb.String()
+}
+
+func TestLongConstantOperands(t *testing.T) {
+	pad := constantPadding(300)
+	tests := []struct {
+		name   string
+		source string
+		output string
+		ops    []string
+	}{
+		{"constant", pad + "print 1000;", "1000\n", []string{"OP_CONSTANT_LONG"}},
+		{"global", pad + "var g = 1; g = g + 1; print g;", "2\n",
+			[]string{"OP_DEFINE_GLOBAL_LONG", "OP_SET_GLOBAL_LONG", "OP_GET_GLOBAL_LONG"}},
+		{"class", pad + "class C { m() { return this.x; } } var c = C(); c.x = 7; print c.m(); print c.x;", "7\n7\n",
+			[]string{"OP_CLASS_LONG", "OP_METHOD_LONG", "OP_SET_PROPERTY_LONG", "OP_GET_PROPERTY_LONG"}},
+		{"closure", pad + `fun f() { return "f"; } print f();`, "f\n", []string{"OP_CLOSURE_LONG"}},
+		{"closure with upvalues", "fun outer() { var a = 1; var b = 2; " + pad +
+			"fun inner() { return a + b; } return inner; } print outer()();", "3\n", []string{"OP_CLOSURE_LONG"}},
+		{"super", `class A { m() { return "A"; } } class B < A { m() { ` + pad + "return super.m(); } } print B().m();",
+			"A\n", []string{"OP_GET_SUPER_LONG"}},
+	}
+	for _, test := range tests {
+		code := disassemble(t, test.source)
+		for _, op := range test.ops {
+			if !strings.Contains(code, op+" ") {
+				t.Errorf("%s: disassembly does not contain %s", test.name, op)
+			}
+		}
+		if out, err := interpret(test.source); err != nil || out != test.output {
+			t.Errorf("%s: printed %q, %v; want %q", test.name, out, err, test.output)
+		}
+	}
+}
+
+func TestLongConstantBoundary(t *testing.T) {
+	// N.B. the padding takes constants 0 to 254, so "a" is the last constant with an 8-bit index and "b" the first
+	// which needs 24 bits
+	source := constantPadding(255) + `print "a"; print "b";`
+	code := disassemble(t, source)
+	for _, want := range []string{
+		"OP_CONSTANT       255 'a'\n",
+		"OP_CONSTANT_LONG  256 'b'\n",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("disassembly does not contain %q:\n%s", want, code)
+		}
+	}
+	expectOutput(t, source, "a\nb\n")
+}
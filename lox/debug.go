@@ -0,0 +1,184 @@
+package lox
+
+import (
+	"fmt"
+	"io"
+)
+
+func DisassembleChunk(w io.Writer, c *Chunk, name string) {
+	fmt.Fprintf(w, "== %s ==\n", name)
+	for offset := 0; offset < c.Count(); {
+		offset = disassembleInstruction(w, c, offset)
+	}
+}
+
+func disassembleInstruction(w io.Writer, chunk *Chunk, offset int) int {
+	fmt.Fprintf(w, "%04d ", offset)
+	if line := chunk.GetLine(offset); offset > 0 && line == chunk.GetLine(offset-1) {
+		fmt.Fprintf(w, "   | ")
+	} else {
+		fmt.Fprintf(w, "%4d ", line)
+	}
+	instruction := chunk.Code[offset]
+	switch instruction {
+	case OP_RETURN:
+		return simpleInstruction(w, "OP_RETURN", offset)
+	case OP_CONSTANT:
+		return constantInstruction(w, "OP_CONSTANT", chunk, offset)
+	case OP_NIL:
+		return simpleInstruction(w, "OP_NIL", offset)
+	case OP_TRUE:
+		return simpleInstruction(w, "OP_TRUE", offset)
+	case OP_FALSE:
+		return simpleInstruction(w, "OP_FALSE", offset)
+	case OP_EQUAL:
+		return simpleInstruction(w, "OP_EQUAL", offset)
+	case OP_GREATER:
+		return simpleInstruction(w, "OP_GREATER", offset)
+	case OP_LESS:
+		return simpleInstruction(w, "OP_LESS", offset)
+	case OP_NOT_EQUAL:
+		return simpleInstruction(w, "OP_NOT_EQUAL", offset)
+	case OP_GREATER_EQUAL:
+		return simpleInstruction(w, "OP_GREATER_EQUAL", offset)
+	case OP_LESS_EQUAL:
+		return simpleInstruction(w, "OP_LESS_EQUAL", offset)
+	case OP_ADD:
+		return simpleInstruction(w, "OP_ADD", offset)
+	case OP_SUBTRACT:
+		return simpleInstruction(w, "OP_SUBTRACT", offset)
+	case OP_MULTIPLY:
+		return simpleInstruction(w, "OP_MULTIPLY", offset)
+	case OP_DIVIDE:
+		return simpleInstruction(w, "OP_DIVIDE", offset)
+	case OP_NOT:
+		return simpleInstruction(w, "OP_NOT", offset)
+	case OP_NEGATE:
+		return simpleInstruction(w, "OP_NEGATE", offset)
+	case OP_PRINT:
+		return simpleInstruction(w, "OP_PRINT", offset)
+	case OP_POP:
+		return simpleInstruction(w, "OP_POP", offset)
+	case OP_DEFINE_GLOBAL:
+		return constantInstruction(w, "OP_DEFINE_GLOBAL", chunk, offset)
+	case OP_GET_GLOBAL:
+		return constantInstruction(w, "OP_GET_GLOBAL", chunk, offset)
+	case OP_SET_GLOBAL:
+		return constantInstruction(w, "OP_SET_GLOBAL", chunk, offset)
+	case OP_GET_LOCAL:
+		return byteInstruction(w, "OP_GET_LOCAL", chunk, offset)
+	case OP_SET_LOCAL:
+		return byteInstruction(w, "OP_SET_LOCAL", chunk, offset)
+	case OP_JUMP:
+		return jumpInstruction(w, "OP_JUMP", 1, chunk, offset)
+	case OP_JUMP_IF_FALSE:
+		return jumpInstruction(w, "OP_JUMP_IF_FALSE", 1, chunk, offset)
+	case OP_LOOP:
+		return jumpInstruction(w, "OP_LOOP", -1, chunk, offset)
+	case OP_CALL:
+		return byteInstruction(w, "OP_CALL", chunk, offset)
+	case OP_CLOSURE:
+		return closureInstruction(w, "OP_CLOSURE", chunk, offset)
+	case OP_GET_UPVALUE:
+		return byteInstruction(w, "OP_GET_UPVALUE", chunk, offset)
+	case OP_SET_UPVALUE:
+		return byteInstruction(w, "OP_SET_UPVALUE", chunk, offset)
+	case OP_CLOSE_UPVALUE:
+		return simpleInstruction(w, "OP_CLOSE_UPVALUE", offset)
+	case OP_CLASS:
+		return constantInstruction(w, "OP_CLASS", chunk, offset)
+	case OP_GET_PROPERTY:
+		return constantInstruction(w, "OP_GET_PROPERTY", chunk, offset)
+	case OP_SET_PROPERTY:
+		return constantInstruction(w, "OP_SET_PROPERTY", chunk, offset)
+	case OP_METHOD:
+		return constantInstruction(w, "OP_METHOD", chunk, offset)
+	case OP_INHERIT:
+		return simpleInstruction(w, "OP_INHERIT", offset)
+	case OP_GET_SUPER:
+		return constantInstruction(w, "OP_GET_SUPER", chunk, offset)
+	case OP_CONSTANT_LONG:
+		return constantLongInstruction(w, "OP_CONSTANT_LONG", chunk, offset)
+	case OP_DEFINE_GLOBAL_LONG:
+		return constantLongInstruction(w, "OP_DEFINE_GLOBAL_LONG", chunk, offset)
+	case OP_GET_GLOBAL_LONG:
+		return constantLongInstruction(w, "OP_GET_GLOBAL_LONG", chunk, offset)
+	case OP_SET_GLOBAL_LONG:
+		return constantLongInstruction(w, "OP_SET_GLOBAL_LONG", chunk, offset)
+	case OP_CLOSURE_LONG:
+		return closureInstruction(w, "OP_CLOSURE_LONG", chunk, offset)
+	case OP_CLASS_LONG:
+		return constantLongInstruction(w, "OP_CLASS_LONG", chunk, offset)
+	case OP_GET_PROPERTY_LONG:
+		return constantLongInstruction(w, "OP_GET_PROPERTY_LONG", chunk, offset)
+	case OP_SET_PROPERTY_LONG:
+		return constantLongInstruction(w, "OP_SET_PROPERTY_LONG", chunk, offset)
+	case OP_METHOD_LONG:
+		return constantLongInstruction(w, "OP_METHOD_LONG", chunk, offset)
+	case OP_GET_SUPER_LONG:
+		return constantLongInstruction(w, "OP_GET_SUPER_LONG", chunk, offset)
+	default:
+		fmt.Fprintf(w, "Unknown opcode %d\n", instruction)
+		return offset + 1
+	}
+}
+
+func constantInstruction(w io.Writer, name string, chunk *Chunk, offset int) int {
+	constant := chunk.Code[offset+1]
+	fmt.Fprintf(w, "%-16s %4d '", name, constant)
+	chunk.constants.values[constant].Fprint(w)
+	fmt.Fprintf(w, "'\n")
+	return offset + 2
+}
+
+func constantLongInstruction(w io.Writer, name string, chunk *Chunk, offset int) int {
+	constant := readUint24(chunk.Code, offset+1)
+	fmt.Fprintf(w, "%-16s %4d '", name, constant)
+	chunk.constants.values[constant].Fprint(w)
+	fmt.Fprintf(w, "'\n")
+	return offset + 4
+}
+
+func closureInstruction(w io.Writer, name string, chunk *Chunk, offset int) int {
+	var constant int
+	if chunk.Code[offset] == OP_CLOSURE_LONG {
+		constant = readUint24(chunk.Code, offset+1)
+		offset += 4
+	} else {
+		constant = int(chunk.Code[offset+1])
+		offset += 2
+	}
+	fmt.Fprintf(w, "%-16s %4d ", name, constant)
+	chunk.constants.values[constant].Fprint(w)
+	fmt.Fprintln(w)
+
+	function := asFunction(chunk.constants.values[constant])
+	for j := 0; j < function.upvalueCount; j++ {
+		isLocal := chunk.Code[offset]
+		index := chunk.Code[offset+1]
+		kind := "upvalue"
+		if isLocal == 1 {
+			kind = "local"
+		}
+		fmt.Fprintf(w, "%04d    |                     %s %d\n", offset, kind, index)
+		offset += 2
+	}
+	return offset
+}
+
+func byteInstruction(w io.Writer, name string, chunk *Chunk, offset int) int {
+	slot := chunk.Code[offset+1]
+	fmt.Fprintf(w, "%-16s %4d\n", name, slot)
+	return offset + 2
+}
+
+func jumpInstruction(w io.Writer, name string, sign int, chunk *Chunk, offset int) int {
+	jump := int(chunk.Code[offset+1])<<8 | int(chunk.Code[offset+2])
+	fmt.Fprintf(w, "%-16s %4d -> %d\n", name, offset, offset+3+sign*jump)
+	return offset + 3
+}
+
+func simpleInstruction(w io.Writer, name string, offset int) int {
+	fmt.Fprintf(w, "%s\n", name)
+	return offset + 1
+}
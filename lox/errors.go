@@ -0,0 +1,178 @@
+package lox
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrCompile = errors.New("compile error")
+	ErrRuntime = errors.New("runtime error")
+)
+
+// CompileError describes a single error reported by the compiler.
+type CompileError struct {
+	Line    int
+	Column  int    // N.B. 1-based, counted in bytes
+	Lexeme  string // the text of the offending token; empty at the end of input or if the scanner rejected it
+	Message string
+	Snippet *Snippet // the offending source line; nil if it is not known
+
+	tokenType tokenType
+}
+
+func (e *CompileError) Error() string {
+	var where string
+	switch e.tokenType {
+	case tokenEOF:
+		where = " at end"
+	case tokenError:
+		// the message already says what went wrong
+	default:
+		where = fmt.Sprintf(" at '%s'", e.Lexeme)
+	}
+	msg := fmt.Sprintf("[line %d] Error%s: %s", e.Line, where, e.Message)
+	if e.Snippet != nil {
+		msg += "\n" + e.Snippet.String()
+	}
+	return msg
+}
+
+// CompileErrors holds every error reported while compiling a script, in source order.
+type CompileErrors []*CompileError
+
+func (e CompileErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns every error in the list. N.B. errors.Is and errors.As only look through this from go 1.20 on; As
+// below covers earlier versions.
+func (e CompileErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// As sets target to the first error in the list, if target is a **CompileError, so that errors.As finds it on any
+// version of go.
+func (e CompileErrors) As(target interface{}) bool {
+	first, ok := target.(**CompileError)
+	if !ok || len(e) == 0 {
+		return false
+	}
+	*first = e[0]
+	return true
+}
+
+// Is reports CompileErrors as ErrCompile, so callers can check for any compile error with errors.Is.
+func (e CompileErrors) Is(target error) bool {
+	return target == ErrCompile
+}
+
+// RuntimeError describes an error raised while running a script.
+type RuntimeError struct {
+	Message string
+	Op      byte // the opcode of the instruction which failed
+	Offset  int  // the offset of that instruction in its function's chunk
+	Frames  []StackFrame
+	Snippet *Snippet // the source line of the failed instruction; nil if it is not known
+	GoStack []byte   // the go stack trace if the error was caused by a panic inside the VM; nil otherwise
+}
+
+// StackFrame describes one call on the stack when a RuntimeError was raised. Frames are ordered innermost first.
+type StackFrame struct {
+	Function string // empty for the top-level script
+	File     string
+	Line     int
+	Column   int // N.B. 1-based, counted in bytes; zero if it is not known
+}
+
+func (e *RuntimeError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.Message)
+	if e.Snippet != nil {
+		sb.WriteString("\n")
+		sb.WriteString(e.Snippet.String())
+	}
+	for _, frame := range e.Frames {
+		fmt.Fprintf(&sb, "\n[line %d] in ", frame.Line)
+		if frame.Function == "" {
+			sb.WriteString("script")
+		} else {
+			fmt.Fprintf(&sb, "%s()", frame.Function)
+		}
+	}
+	return sb.String()
+}
+
+// Is reports a RuntimeError as ErrRuntime.
+func (e *RuntimeError) Is(target error) bool {
+	return target == ErrRuntime
+}
+
+// Snippet is a line of source with a range of it marked, which is rendered as the line with a caret underline.
+type Snippet struct {
+	Text   string // the source line, without its line terminator
+	Column int    // 1-based column at which the underline starts
+	Length int    // the length of the underline in bytes; at least 1
+}
+
+// newSnippet returns a Snippet marking length bytes of source starting at offset, or nil if offset is out of range.
+// The underline is cut short at the end of the line.
+func newSnippet(source string, offset, length int) *Snippet {
+	if offset < 0 || offset > len(source) {
+		return nil
+	}
+	start := strings.LastIndexByte(source[:offset], '\n') + 1
+	end := len(source)
+	if i := strings.IndexByte(source[offset:], '\n'); i >= 0 {
+		end = offset + i
+	}
+	text := strings.TrimSuffix(source[start:end], "\r")
+	if offset+length > start+len(text) {
+		length = start + len(text) - offset
+	}
+	if length < 1 {
+		length = 1
+	}
+	return &Snippet{Text: text, Column: offset - start + 1, Length: length}
+}
+
+func (s *Snippet) String() string {
+	var sb strings.Builder
+	sb.WriteString("    ")
+	sb.WriteString(s.Text)
+	sb.WriteString("\n    ")
+	prefix := s.Text
+	if s.Column < 1 {
+		prefix = ""
+	} else if s.Column-1 < len(prefix) {
+		prefix = prefix[:s.Column-1]
+	}
+	for _, r := range prefix {
+		// N.B. tabs are kept so the caret lines up however wide the terminal renders them
+		if r == '\t' {
+			sb.WriteByte('\t')
+		} else {
+			sb.WriteByte(' ')
+		}
+	}
+	marked := s.Text[len(prefix):]
+	if len(marked) > s.Length {
+		marked = marked[:s.Length]
+	}
+	width := utf8.RuneCountInString(marked)
+	if width < 1 {
+		width = 1
+	}
+	sb.WriteString(strings.Repeat("^", width))
+	return sb.String()
+}
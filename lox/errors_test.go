@@ -0,0 +1,156 @@
+package lox
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const badScript = "print 1 +;\nvar = 3;\nprint \"a\""
+
+func TestCompileErrors(t *testing.T) {
+	_, err := Compile(badScript)
+	errs, ok := err.(CompileErrors)
+	if !ok {
+		t.Fatalf("Compile returned %T, want CompileErrors", err)
+	}
+	want := []struct {
+		line, column int
+		lexeme       string
+		message      string
+	}{
+		{1, 10, ";", "expect expression."},
+		{2, 5, "=", "Expect variable name."},
+		{3, 10, "", "Expect ';' after value."},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors, want %d:\n%v", len(errs), len(want), err)
+	}
+	for i, w := range want {
+		e := errs[i]
+		if e.Line != w.line || e.Column != w.column || e.Lexeme != w.lexeme || e.Message != w.message {
+			t.Errorf("error %d = {%d, %d, %q, %q}, want {%d, %d, %q, %q}", i, e.Line, e.Column, e.Lexeme, e.Message,
+				w.line, w.column, w.lexeme, w.message)
+		}
+	}
+	if unwrapped := errs.Unwrap(); len(unwrapped) != len(errs) || unwrapped[1] != error(errs[1]) {
+		t.Errorf("Unwrap() = %v, want every error in order", unwrapped)
+	}
+}
+
+func TestCompileErrorsAsAndIs(t *testing.T) {
+	_, err := Compile(badScript)
+	var first *CompileError
+	if !errors.As(err, &first) || first.Line != 1 {
+		t.Errorf("errors.As found %v, want the first error", first)
+	}
+	if !errors.Is(err, ErrCompile) {
+		t.Errorf("errors.Is(err, ErrCompile) = false")
+	}
+	if errors.Is(err, ErrRuntime) {
+		t.Errorf("errors.Is(err, ErrRuntime) = true")
+	}
+}
+
+// TestCompileErrorOutput checks what the VM writes to stderr, which is what the command-line front end prints.
+func TestCompileErrorOutput(t *testing.T) {
+	var stderr bytes.Buffer
+	if err := NewVM(WithStderr(&stderr)).Interpret(badScript); err == nil {
+		t.Fatal("Interpret returned no error")
+	}
+	want := "[line 1] Error at ';': expect expression.\n" +
+		"    print 1 +;\n" +
+		"             ^\n" +
+		"[line 2] Error at '=': Expect variable name.\n" +
+		"    var = 3;\n" +
+		"        ^\n" +
+		"[line 3] Error at end: Expect ';' after value.\n"
+	if stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+}
+
+const failingScript = `fun inner() {
+  return 1 + nil;
+}
+fun outer() {
+  inner();
+}
+outer();
+`
+
+func TestRuntimeError(t *testing.T) {
+	var stderr bytes.Buffer
+	err := NewVM(WithStderr(&stderr)).InterpretFile("test.lox", failingScript)
+	rerr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("InterpretFile returned %v, want a *RuntimeError", err)
+	}
+	if rerr.Message != "Operands must be two numbers or two strings." {
+		t.Errorf("Message = %q", rerr.Message)
+	}
+	// N.B. inner's chunk is OP_CONSTANT 1, OP_NIL, OP_ADD
+	if rerr.Op != OP_ADD || rerr.Offset != 3 {
+		t.Errorf("Op, Offset = %d, %d; want OP_ADD at 3", rerr.Op, rerr.Offset)
+	}
+	wantFrames := []StackFrame{
+		{Function: "inner", File: "test.lox", Line: 2, Column: 12},
+		{Function: "outer", File: "test.lox", Line: 5, Column: 8},
+		{Function: "", File: "test.lox", Line: 7, Column: 6},
+	}
+	if !reflect.DeepEqual(rerr.Frames, wantFrames) {
+		t.Errorf("Frames = %+v, want %+v", rerr.Frames, wantFrames)
+	}
+	if len(rerr.GoStack) != 0 {
+		t.Errorf("a runtime error raised by the script has a go stack")
+	}
+	if !errors.Is(err, ErrRuntime) || errors.Is(err, ErrCompile) {
+		t.Errorf("errors.Is does not report err as only ErrRuntime")
+	}
+	want := "Operands must be two numbers or two strings.\n" +
+		"      return 1 + nil;\n" +
+		"               ^\n" +
+		"[line 2] in inner()\n" +
+		"[line 5] in outer()\n" +
+		"[line 7] in script\n"
+	if stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+}
+
+func TestResetAfterRuntimeError(t *testing.T) {
+	var out bytes.Buffer
+	vm := NewVM(WithStdout(&out))
+	// N.B. g captures a, so there is an open upvalue when the error is raised
+	source := "var before = 1; fun f() { var a = 1; fun g() { return a; } return a + nil; } f();"
+	if err := vm.Interpret(source); err == nil {
+		t.Fatal("Interpret returned no error")
+	}
+	if vm.stackTop != 0 || vm.frameCount != 0 || vm.openUpvalues != nil {
+		t.Errorf("after an error, stackTop = %d, frameCount = %d, openUpvalues = %v; want all reset", vm.stackTop,
+			vm.frameCount, vm.openUpvalues)
+	}
+
+	err := vm.Interpret("print before;\nprint -nil;")
+	if out.String() != "1\n" {
+		t.Errorf("printed %q, want the global defined before the first error", out.String())
+	}
+	rerr, ok := err.(*RuntimeError)
+	if !ok || len(rerr.Frames) != 1 || rerr.Frames[0].Line != 2 {
+		t.Errorf("second error = %v, want one frame on line 2, with nothing left from the first", err)
+	}
+}
+
+func TestCompileErrorAtMultiLineString(t *testing.T) {
+	_, err := Compile("print 1 \"two\nlines\";")
+	var first *CompileError
+	if !errors.As(err, &first) {
+		t.Fatalf("Compile returned %v, want a CompileError", err)
+	}
+	// N.B. the line and column must name the same position, which is where the string starts
+	if first.Line != 1 || first.Column != 9 || first.Snippet == nil || first.Snippet.Text != "print 1 \"two" {
+		t.Errorf("error at line %d, column %d, snippet %+v; want line 1, column 9", first.Line, first.Column,
+			first.Snippet)
+	}
+}
@@ -0,0 +1,53 @@
+package lox
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var startTime = time.Now()
+
+// clockNative returns the number of seconds since the interpreter started.
+func clockNative(args []Value) (Value, error) {
+	return NumberVal(time.Since(startTime).Seconds()), nil
+}
+
+// inputNative reads a line from stdin, returning nil at the end of input.
+func (v *VM) inputNative(args []Value) (Value, error) {
+	line, err := v.stdin.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return NilVal(), nil
+	}
+	if err != nil && err != io.EOF {
+		return NilVal(), fmt.Errorf("could not read from stdin: %v", err)
+	}
+	return ObjVal(v.copyString(strings.TrimRight(line, "\r\n"))), nil
+}
+
+// typeOfNative returns the name of the type of its argument.
+func (v *VM) typeOfNative(args []Value) (Value, error) {
+	return ObjVal(v.copyString(typeName(args[0]))), nil
+}
+
+func typeName(v Value) string {
+	switch v.Type() {
+	case VAL_BOOL:
+		return "boolean"
+	case VAL_NIL:
+		return "nil"
+	case VAL_NUMBER:
+		return "number"
+	}
+	switch objType(v) {
+	case OBJ_CLASS:
+		return "class"
+	case OBJ_INSTANCE:
+		return "instance"
+	case OBJ_STRING:
+		return "string"
+	default:
+		return "function" // N.B. closures, bound methods and natives are all callable
+	}
+}
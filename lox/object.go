@@ -0,0 +1,269 @@
+package lox
+
+import (
+	"fmt"
+	"io"
+)
+
+type ObjType uint8
+
+const (
+	OBJ_BOUND_METHOD ObjType = iota
+	OBJ_CLASS
+	OBJ_CLOSURE
+	OBJ_FUNCTION
+	OBJ_INSTANCE
+	OBJ_NATIVE
+	OBJ_STRING
+	OBJ_UPVALUE
+)
+
+// Obj is implemented by every heap-allocated Lox value. N.B. go's garbage collector owns the memory, so there is no
+// intrusive 'next' pointer or freeObjects() here.
+type Obj interface {
+	Type() ObjType
+	Fprint(w io.Writer)
+}
+
+func objType(v Value) ObjType {
+	return v.AsObj().Type()
+}
+
+func isObjType(v Value, t ObjType) bool {
+	return isObj(v) && objType(v) == t
+}
+
+func isBoundMethod(v Value) bool {
+	return isObjType(v, OBJ_BOUND_METHOD)
+}
+
+func asBoundMethod(v Value) *ObjBoundMethod {
+	return v.AsObj().(*ObjBoundMethod)
+}
+
+func isClass(v Value) bool {
+	return isObjType(v, OBJ_CLASS)
+}
+
+func asClass(v Value) *ObjClass {
+	return v.AsObj().(*ObjClass)
+}
+
+func isClosure(v Value) bool {
+	return isObjType(v, OBJ_CLOSURE)
+}
+
+func asClosure(v Value) *ObjClosure {
+	return v.AsObj().(*ObjClosure)
+}
+
+func isFunction(v Value) bool {
+	return isObjType(v, OBJ_FUNCTION)
+}
+
+func asFunction(v Value) *ObjFunction {
+	return v.AsObj().(*ObjFunction)
+}
+
+func isInstance(v Value) bool {
+	return isObjType(v, OBJ_INSTANCE)
+}
+
+func asInstance(v Value) *ObjInstance {
+	return v.AsObj().(*ObjInstance)
+}
+
+func isNative(v Value) bool {
+	return isObjType(v, OBJ_NATIVE)
+}
+
+func asNative(v Value) *ObjNative {
+	return v.AsObj().(*ObjNative)
+}
+
+func isString(v Value) bool {
+	return isObjType(v, OBJ_STRING)
+}
+
+func asString(v Value) *ObjString {
+	return v.AsObj().(*ObjString)
+}
+
+type ObjFunction struct {
+	arity        int
+	upvalueCount int
+	chunk        Chunk
+	name         *ObjString // N.B. nil for the top-level script
+}
+
+func newObjFunction() *ObjFunction {
+	return &ObjFunction{}
+}
+
+func (of *ObjFunction) Type() ObjType {
+	return OBJ_FUNCTION
+}
+
+func (of *ObjFunction) Fprint(w io.Writer) {
+	if of.name == nil {
+		fmt.Fprintf(w, "<script>")
+		return
+	}
+	fmt.Fprintf(w, "<fn %s>", of.name.value)
+}
+
+type ObjBoundMethod struct {
+	receiver Value
+	method   *ObjClosure
+}
+
+func newObjBoundMethod(receiver Value, method *ObjClosure) *ObjBoundMethod {
+	return &ObjBoundMethod{receiver: receiver, method: method}
+}
+
+func (ob *ObjBoundMethod) Type() ObjType {
+	return OBJ_BOUND_METHOD
+}
+
+func (ob *ObjBoundMethod) Fprint(w io.Writer) {
+	ob.method.function.Fprint(w)
+}
+
+type ObjClass struct {
+	name    *ObjString
+	methods table
+}
+
+func newObjClass(name *ObjString) *ObjClass {
+	return &ObjClass{name: name}
+}
+
+func (oc *ObjClass) Type() ObjType {
+	return OBJ_CLASS
+}
+
+func (oc *ObjClass) Fprint(w io.Writer) {
+	fmt.Fprintf(w, "%s", oc.name.value)
+}
+
+type ObjInstance struct {
+	klass  *ObjClass
+	fields table
+}
+
+func newObjInstance(klass *ObjClass) *ObjInstance {
+	return &ObjInstance{klass: klass}
+}
+
+func (oi *ObjInstance) Type() ObjType {
+	return OBJ_INSTANCE
+}
+
+func (oi *ObjInstance) Fprint(w io.Writer) {
+	fmt.Fprintf(w, "%s instance", oi.klass.name.value)
+}
+
+type ObjClosure struct {
+	function *ObjFunction
+	upvalues []*ObjUpvalue
+}
+
+func newObjClosure(function *ObjFunction) *ObjClosure {
+	return &ObjClosure{
+		function: function,
+		upvalues: make([]*ObjUpvalue, function.upvalueCount),
+	}
+}
+
+func (oc *ObjClosure) Type() ObjType {
+	return OBJ_CLOSURE
+}
+
+func (oc *ObjClosure) Fprint(w io.Writer) {
+	oc.function.Fprint(w)
+}
+
+// ObjUpvalue refers to a local variable captured by a closure. While the variable is still on the stack the upvalue is
+// 'open' and location points into the VM's stack; once closed, the value is moved into closed and location points
+// there instead.
+type ObjUpvalue struct {
+	location *Value
+	slot     int // N.B. the stack index of an open upvalue; keeps vm.openUpvalues sorted without pointer arithmetic
+	closed   Value
+	next     *ObjUpvalue
+}
+
+func newObjUpvalue(slot *Value, index int) *ObjUpvalue {
+	return &ObjUpvalue{location: slot, slot: index, closed: NilVal()}
+}
+
+func (ou *ObjUpvalue) Type() ObjType {
+	return OBJ_UPVALUE
+}
+
+func (ou *ObjUpvalue) Fprint(w io.Writer) {
+	fmt.Fprintf(w, "upvalue")
+}
+
+// NativeFn is a go function callable from Lox. A non-nil error is reported as a runtime error.
+type NativeFn func(args []Value) (Value, error)
+
+type ObjNative struct {
+	name     *ObjString
+	arity    int
+	function NativeFn
+}
+
+func newObjNative(name *ObjString, arity int, function NativeFn) *ObjNative {
+	return &ObjNative{name: name, arity: arity, function: function}
+}
+
+func (on *ObjNative) Type() ObjType {
+	return OBJ_NATIVE
+}
+
+func (on *ObjNative) Fprint(w io.Writer) {
+	fmt.Fprintf(w, "<native fn>")
+}
+
+type ObjString struct {
+	value string
+	hash  uint32
+}
+
+func (os *ObjString) Type() ObjType {
+	return OBJ_STRING
+}
+
+func (os *ObjString) Fprint(w io.Writer) {
+	fmt.Fprintf(w, "%s", os.value)
+}
+
+// newObjString allocates a string without interning it. N.B. the compiler uses this for constants; the VM interns
+// them, along with every string it creates at runtime, using copyString.
+func newObjString(s string) *ObjString {
+	return &ObjString{value: s, hash: hashString(s)}
+}
+
+// copyString returns the interned ObjString for s, allocating it only if the VM has not seen s before. N.B. this plays
+// the role of both copyString() and takeString() from the book; go strings are immutable, so there is no ownership to
+// transfer.
+func (v *VM) copyString(s string) *ObjString {
+	hash := hashString(s)
+	if interned := tableFindString(&v.strings, s, hash); interned != nil {
+		return interned
+	}
+	result := &ObjString{value: s, hash: hash}
+	tableSet(&v.strings, result, NilVal())
+	return result
+}
+
+// hashString implements FNV-1a.
+func hashString(s string) uint32 {
+	hash := uint32(2166136261)
+	for i := 0; i < len(s); i++ {
+		hash ^= uint32(s[i])
+		hash *= 16777619
+	}
+	return hash
+}
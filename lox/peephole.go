@@ -0,0 +1,151 @@
+package lox
+
+import "math"
+
+// optimize runs a peephole pass over a compiled chunk, rewriting common instruction sequences into shorter ones:
+//
+//   - a jump which lands on an OP_JUMP is retargeted to wherever that jump lands;
+//   - a constant load followed by OP_POP is removed;
+//   - OP_NOT, OP_NOT following an instruction which always produces a boolean is removed;
+//   - OP_EQUAL, OP_NOT becomes OP_NOT_EQUAL, and OP_NOT_EQUAL, OP_NOT becomes OP_EQUAL.
+//
+// N.B. OP_LESS, OP_NOT is not rewritten as OP_GREATER_EQUAL (nor OP_GREATER, OP_NOT as OP_LESS_EQUAL), since the two
+// differ when either operand is NaN. The line and span of every instruction which survives are kept.
+func optimize(chunk *Chunk) {
+	threadJumps(chunk)
+	for rewriteSequences(chunk) {
+	}
+}
+
+// peepholeInstruction is a decoded instruction, as seen by rewriteSequences.
+type peepholeInstruction struct {
+	offset int
+	length int
+	op     byte // N.B. may differ from the opcode in the chunk, if the instruction has been rewritten
+	drop   bool
+}
+
+func threadJumps(chunk *Chunk) {
+	code := chunk.Code
+	for offset := 0; offset < len(code); offset += instructionLength(chunk, offset) {
+		if code[offset] != OP_JUMP && code[offset] != OP_JUMP_IF_FALSE {
+			continue
+		}
+		target := jumpTarget(code, offset)
+		if target >= len(code) || code[target] != OP_JUMP {
+			continue
+		}
+		// N.B. OP_JUMP only jumps forward, so this always terminates; it stops short of any target too far away for the
+		// 16-bit operand of the jump at offset
+		for target < len(code) && code[target] == OP_JUMP {
+			next := jumpTarget(code, target)
+			if next-(offset+3) > math.MaxUint16 {
+				break
+			}
+			target = next
+		}
+		setJumpTarget(code, offset, target)
+	}
+}
+
+// rewriteSequences applies one round of rewrites to chunk, and returns true if anything was rewritten.
+func rewriteSequences(chunk *Chunk) bool {
+	var insts []peepholeInstruction
+	targets := make(map[int]bool)
+	for offset := 0; offset < chunk.Count(); {
+		length := instructionLength(chunk, offset)
+		op := chunk.Code[offset]
+		insts = append(insts, peepholeInstruction{offset: offset, length: length, op: op})
+		if op == OP_JUMP || op == OP_JUMP_IF_FALSE || op == OP_LOOP {
+			targets[jumpTarget(chunk.Code, offset)] = true
+		}
+		offset += length
+	}
+
+	changed := false
+	for i := 0; i+1 < len(insts); i++ {
+		a, b := &insts[i], &insts[i+1]
+		if targets[b.offset] {
+			continue // N.B. control may reach b without passing through a
+		}
+		switch {
+		case isConstantLoad(a.op) && b.op == OP_POP:
+			a.drop, b.drop = true, true
+		case a.op == OP_NOT && b.op == OP_NOT && i > 0 && !targets[a.offset] && !insts[i-1].drop &&
+			producesBoolean(insts[i-1].op):
+			a.drop, b.drop = true, true
+		case a.op == OP_EQUAL && b.op == OP_NOT:
+			a.op, b.drop = OP_NOT_EQUAL, true
+		case a.op == OP_NOT_EQUAL && b.op == OP_NOT:
+			a.op, b.drop = OP_EQUAL, true
+		default:
+			continue
+		}
+		changed = true
+		i++
+	}
+	if !changed {
+		return false
+	}
+
+	// N.B. a jump which landed on a dropped instruction lands on the next one which survives
+	rewritten := Chunk{constants: chunk.constants, file: chunk.file, source: chunk.source}
+	newOffsets := make(map[int]int, len(insts)+1)
+	spans := newSpanCursor(&chunk.spans)
+	for _, inst := range insts {
+		newOffsets[inst.offset] = rewritten.Count()
+		if inst.drop {
+			continue
+		}
+		rewritten.WriteSpan(inst.op, chunk.GetLine(inst.offset), spans.at(inst.offset))
+		for i := 1; i < inst.length; i++ {
+			rewritten.WriteSpan(chunk.Code[inst.offset+i], chunk.GetLine(inst.offset+i), spans.at(inst.offset+i))
+		}
+	}
+	newOffsets[chunk.Count()] = rewritten.Count()
+
+	for _, inst := range insts {
+		if inst.drop || (inst.op != OP_JUMP && inst.op != OP_JUMP_IF_FALSE && inst.op != OP_LOOP) {
+			continue
+		}
+		setJumpTarget(rewritten.Code, newOffsets[inst.offset], newOffsets[jumpTarget(chunk.Code, inst.offset)])
+	}
+	*chunk = rewritten
+	return true
+}
+
+// jumpTarget returns the offset at which the jump or loop instruction at offset lands.
+func jumpTarget(code []byte, offset int) int {
+	jump := int(code[offset+1])<<8 | int(code[offset+2])
+	if code[offset] == OP_LOOP {
+		return offset + 3 - jump
+	}
+	return offset + 3 + jump
+}
+
+// setJumpTarget rewrites the operand of the jump or loop instruction at offset so that it lands on target.
+func setJumpTarget(code []byte, offset, target int) {
+	jump := target - (offset + 3)
+	if code[offset] == OP_LOOP {
+		jump = -jump
+	}
+	code[offset+1] = byte((jump >> 8) & 0xff)
+	code[offset+2] = byte(jump & 0xff)
+}
+
+func isConstantLoad(op byte) bool {
+	switch op {
+	case OP_CONSTANT, OP_CONSTANT_LONG, OP_NIL, OP_TRUE, OP_FALSE:
+		return true
+	}
+	return false
+}
+
+// producesBoolean returns true if the instruction op always leaves a boolean on top of the stack.
+func producesBoolean(op byte) bool {
+	switch op {
+	case OP_TRUE, OP_FALSE, OP_NOT, OP_EQUAL, OP_NOT_EQUAL, OP_GREATER, OP_LESS, OP_GREATER_EQUAL, OP_LESS_EQUAL:
+		return true
+	}
+	return false
+}
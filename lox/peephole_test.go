@@ -0,0 +1,104 @@
+package lox
+
+import (
+	"strings"
+	"testing"
+)
+
+// expectOutput fails the test unless source runs without error and prints exactly want.
+func expectOutput(t *testing.T, source, want string) {
+	t.Helper()
+	if out, err := interpret(source); err != nil || out != want {
+		t.Errorf("%q printed %q, %v; want %q", source, out, err, want)
+	}
+}
+
+func TestThreadJumps(t *testing.T) {
+	source := "if (a) { if (b) print 1; else print 2; } else print 3;"
+	chunk := mustCompile(t, source)
+	for offset := 0; offset < chunk.Count(); offset += instructionLength(chunk, offset) {
+		op := chunk.Code[offset]
+		if op != OP_JUMP && op != OP_JUMP_IF_FALSE {
+			continue
+		}
+		if target := jumpTarget(chunk.Code, offset); target < chunk.Count() && chunk.Code[target] == OP_JUMP {
+			t.Errorf("jump at %d lands on another jump at %d", offset, target)
+		}
+	}
+	for _, test := range []struct{ a, b, want string }{
+		{"true", "true", "1\n"}, {"true", "false", "2\n"}, {"false", "true", "3\n"},
+	} {
+		expectOutput(t, "var a = "+test.a+"; var b = "+test.b+";\n"+source, test.want)
+	}
+}
+
+func TestThreadJumpsKeepsDistanceInRange(t *testing.T) {
+	// N.B. each jump over an else branch fits in 16 bits, but the two together do not, so threading the inner jump to
+	// where the outer one lands would overflow its operand.
+	padding := strings.Repeat("print nil;", 25000)
+	source := `if (true) { if (true) print "then"; else {` + padding + `} } else {` + padding + `} print "done";`
+	out, err := interpret(source)
+	if err != nil || out != "then\ndone\n" {
+		if len(out) > 40 {
+			out = out[:40] + "..."
+		}
+		t.Errorf("printed %q, %v; want \"then\\ndone\\n\"", out, err)
+	}
+}
+
+func TestRemoveConstantPop(t *testing.T) {
+	expectOpcodes(t, `1; nil; true; false; "s";`, OP_NIL, OP_RETURN)
+	// N.B. the final pop is also reached by the jump out of 'or', so the constant before it must stay
+	expectOpcodes(t, "a or 1;",
+		OP_GET_GLOBAL, OP_JUMP_IF_FALSE, OP_JUMP, OP_POP, OP_CONSTANT, OP_POP, OP_NIL, OP_RETURN)
+}
+
+func TestRemoveDoubleNot(t *testing.T) {
+	// N.B. !!a converts a to a boolean, so it is only removed when its operand is already a boolean
+	expectOpcodes(t, "print !!a;", OP_GET_GLOBAL, OP_NOT, OP_NOT, OP_PRINT, OP_NIL, OP_RETURN)
+	expectOpcodes(t, "print !!(a < b);", OP_GET_GLOBAL, OP_GET_GLOBAL, OP_LESS, OP_PRINT, OP_NIL, OP_RETURN)
+	expectOutput(t, "var a = 1; print !!a; print !!nil; print !!(a < 2);", "true\nfalse\ntrue\n")
+}
+
+func TestFuseEqualNot(t *testing.T) {
+	expectOpcodes(t, "print !(a == b);", OP_GET_GLOBAL, OP_GET_GLOBAL, OP_NOT_EQUAL, OP_PRINT, OP_NIL, OP_RETURN)
+	expectOpcodes(t, "print !(a != b);", OP_GET_GLOBAL, OP_GET_GLOBAL, OP_EQUAL, OP_PRINT, OP_NIL, OP_RETURN)
+	expectOutput(t, "var a = 1; var b = 2; print !(a == b); print !(a != b); print !(a == a);", "true\nfalse\nfalse\n")
+}
+
+func TestNoRewriteAtJumpTarget(t *testing.T) {
+	// N.B. the jump out of 'and' lands on the OP_NOT, so it must not be fused with the OP_EQUAL before it
+	source := "print !(a and b == c);"
+	expectOpcodes(t, source,
+		OP_GET_GLOBAL, OP_JUMP_IF_FALSE, OP_POP, OP_GET_GLOBAL, OP_GET_GLOBAL, OP_EQUAL, OP_NOT, OP_PRINT, OP_NIL,
+		OP_RETURN)
+	expectOutput(t, "var a = false; var b = 1; var c = 1;\n"+source, "true\n")
+	expectOutput(t, "var a = true; var b = 1; var c = 1;\n"+source, "false\n")
+}
+
+func TestComparisonsWithNaN(t *testing.T) {
+	// N.B. !(a < b) differs from a >= b when either operand is NaN, so it is not rewritten
+	expectOpcodes(t, "print !(a < b);", OP_GET_GLOBAL, OP_GET_GLOBAL, OP_LESS, OP_NOT, OP_PRINT, OP_NIL, OP_RETURN)
+	expectOpcodes(t, "print !(a > b);", OP_GET_GLOBAL, OP_GET_GLOBAL, OP_GREATER, OP_NOT, OP_PRINT, OP_NIL, OP_RETURN)
+	expectOpcodes(t, "print a >= b;", OP_GET_GLOBAL, OP_GET_GLOBAL, OP_GREATER_EQUAL, OP_PRINT, OP_NIL, OP_RETURN)
+	expectOpcodes(t, "print a <= b;", OP_GET_GLOBAL, OP_GET_GLOBAL, OP_LESS_EQUAL, OP_PRINT, OP_NIL, OP_RETURN)
+	expectOpcodes(t, "print a != b;", OP_GET_GLOBAL, OP_GET_GLOBAL, OP_NOT_EQUAL, OP_PRINT, OP_NIL, OP_RETURN)
+
+	const declare = "var zero = 0; var nan = zero / zero;\n"
+	tests := map[string]string{
+		"print nan >= 1;":   "false\n",
+		"print 1 >= nan;":   "false\n",
+		"print nan <= 1;":   "false\n",
+		"print nan <= nan;": "false\n",
+		"print nan != nan;": "true\n",
+		"print nan != 1;":   "true\n",
+		"print !(nan < 1);": "true\n",
+		"print !(nan > 1);": "true\n",
+		"print 0/0 >= 1;":   "false\n", // N.B. these are folded by the compiler rather than run by the VM
+		"print 0/0 <= 1;":   "false\n",
+		"print 0/0 != 0/0;": "true\n",
+	}
+	for source, want := range tests {
+		expectOutput(t, declare+source, want)
+	}
+}
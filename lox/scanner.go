@@ -0,0 +1,343 @@
+package lox
+
+type scanner struct {
+	source    string
+	start     int
+	current   int
+	line      int
+	lineStart int // N.B. offset of the first byte of the current line, so columns can be found without rescanning
+}
+
+func initScanner(s *scanner, source string) {
+	s.source = source
+	s.start = 0
+	s.current = 0
+	s.line = 1
+	s.lineStart = 0
+}
+
+// column returns the 1-based column of the given offset, which must lie on the current line.
+func (s *scanner) column(offset int) int {
+	return offset - s.lineStart + 1
+}
+
+type token struct {
+	typ    tokenType
+	line   int
+	column int // N.B. 1-based, counted in bytes; for an error token, the column of the rejected text
+	start  int // N.B. integer offset into source, not a C-pointer
+	length int
+	source *string
+}
+
+func (s *scanner) scanToken() token {
+	s.skipWhitespace()
+	s.start = s.current
+
+	if s.isAtEnd() {
+		return s.makeToken(tokenEOF)
+	}
+	c := s.advanceScanner()
+	if isAlpha(c) {
+		return s.identifier()
+	}
+	if isDigit(c) {
+		return s.number()
+	}
+	switch c {
+	case '(':
+		return s.makeToken(tokenLeftParen)
+	case ')':
+		return s.makeToken(tokenRightParen)
+	case '{':
+		return s.makeToken(tokenLeftBrace)
+	case '}':
+		return s.makeToken(tokenRightBrace)
+	case ';':
+		return s.makeToken(tokenSemicolon)
+	case ',':
+		return s.makeToken(tokenComma)
+	case '.':
+		return s.makeToken(tokenDot)
+	case '-':
+		return s.makeToken(tokenMinus)
+	case '+':
+		return s.makeToken(tokenPlus)
+	case '/':
+		return s.makeToken(tokenSlash)
+	case '*':
+		return s.makeToken(tokenStar)
+	case '!':
+		if s.match('=') {
+			return s.makeToken(tokenBangEqual)
+		} else {
+			return s.makeToken(tokenBang)
+		}
+	case '=':
+		if s.match('=') {
+			return s.makeToken(tokenEqualEqual)
+		} else {
+			return s.makeToken(tokenEqual)
+		}
+	case '<':
+		if s.match('=') {
+			return s.makeToken(tokenLessEqual)
+		} else {
+			return s.makeToken(tokenLess)
+		}
+	case '>':
+		if s.match('=') {
+			return s.makeToken(tokenGreaterEqual)
+		} else {
+			return s.makeToken(tokenGreater)
+		}
+	case '"':
+		return s.makeString() // N.B. 'string()' is like a reserved keyword in go.
+	}
+	return s.errorToken("unexpected character.")
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') ||
+		(c >= 'A' && c <= 'Z') ||
+		c == '_'
+}
+
+func (s *scanner) identifier() token {
+	for isAlpha(s.peek()) || isDigit(s.peek()) {
+		s.advanceScanner()
+	}
+	return s.makeToken(s.identifierType())
+}
+
+func (s *scanner) identifierType() tokenType {
+	switch s.source[s.start] {
+	case 'a':
+		return s.checkKeyword(1, 2, "nd", tokenAnd)
+	case 'c':
+		return s.checkKeyword(1, 4, "lass", tokenClass)
+	case 'e':
+		return s.checkKeyword(1, 3, "lse", tokenElse)
+	case 'f':
+		if s.current-s.start > 1 {
+			switch s.source[s.start+1] {
+			case 'a':
+				return s.checkKeyword(2, 3, "lse", tokenFalse)
+			case 'o':
+				return s.checkKeyword(2, 1, "r", tokenFor)
+			case 'u':
+				return s.checkKeyword(2, 1, "n", tokenFun)
+			}
+		}
+	case 'i':
+		return s.checkKeyword(1, 1, "f", tokenIf)
+	case 'n':
+		return s.checkKeyword(1, 2, "il", tokenNil)
+	case 'o':
+		return s.checkKeyword(1, 1, "r", tokenOr)
+	case 'p':
+		return s.checkKeyword(1, 4, "rint", tokenPrint)
+	case 'r':
+		return s.checkKeyword(1, 5, "eturn", tokenReturn)
+	case 's':
+		return s.checkKeyword(1, 4, "uper", tokenSuper)
+	case 't':
+		if s.current-s.start > 1 {
+			switch s.source[s.start+1] {
+			case 'h':
+				return s.checkKeyword(2, 2, "is", tokenThis)
+			case 'r':
+				return s.checkKeyword(2, 2, "ue", tokenTrue)
+			}
+		}
+	case 'v':
+		return s.checkKeyword(1, 2, "ar", tokenVar)
+	case 'w':
+		return s.checkKeyword(1, 4, "hile", tokenWhile)
+	}
+	return tokenIdentifier
+}
+
+func (s *scanner) checkKeyword(start, length int, rest string, typ tokenType) tokenType {
+	if s.current-s.start == start+length &&
+		string(s.source[s.start+start:s.start+start+length]) == rest {
+		return typ
+	}
+	return tokenIdentifier
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (s *scanner) number() token {
+	for isDigit(s.peek()) {
+		s.advanceScanner()
+	}
+	// check for a fractional part
+	if s.peek() == '.' && isDigit(s.peekNext()) {
+		s.advanceScanner()
+		for isDigit(s.peek()) {
+			s.advanceScanner()
+		}
+	}
+	return s.makeToken(tokenNumber)
+}
+
+func (s *scanner) makeString() token {
+	// N.B. a string which spans lines is reported at the line and column where it starts, so both are found before a
+	// newline in the string moves them on
+	line, column := s.line, s.column(s.start)
+	for s.peek() != '"' && !s.isAtEnd() {
+		if s.peek() == '\n' {
+			s.line++
+			s.lineStart = s.current + 1
+		}
+		s.advanceScanner()
+	}
+	var tok token
+	if s.isAtEnd() {
+		tok = s.errorToken("unterminated string.")
+	} else {
+		s.advanceScanner()
+		tok = s.makeToken(tokenString)
+	}
+	tok.line, tok.column = line, column
+	return tok
+}
+
+func (s *scanner) skipWhitespace() {
+	for {
+		c := s.peek()
+		switch c {
+		case ' ':
+			s.advanceScanner()
+		case '\r':
+			s.advanceScanner()
+		case '\t':
+			s.advanceScanner()
+		case '\n':
+			s.line++
+			s.advanceScanner()
+			s.lineStart = s.current
+		case '/': // skip comments
+			if s.peekNext() == '/' {
+				for s.peek() != '\n' && !s.isAtEnd() {
+					s.advanceScanner()
+				}
+			} else {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (s *scanner) peek() byte {
+	if s.current >= len(s.source) { // fake null-terminated strings -.-
+		return byte(0)
+	}
+	return s.source[s.current]
+}
+func (s *scanner) peekNext() byte {
+	if s.current+1 >= len(s.source) {
+		return byte(0)
+	}
+	return s.source[s.current+1]
+}
+
+func (s *scanner) advanceScanner() byte {
+	s.current++
+	return s.source[s.current-1]
+}
+
+func (s *scanner) match(expected byte) bool {
+	if s.isAtEnd() {
+		return false
+	}
+	if s.source[s.current] != expected {
+		return false
+	}
+	s.current++
+	return true
+}
+
+func (s *scanner) makeToken(typ tokenType) token {
+	return token{
+		typ:    typ,
+		start:  s.start,
+		length: s.current - s.start,
+		line:   s.line,
+		column: s.column(s.start),
+		source: &s.source,
+	}
+}
+
+func (s *scanner) errorToken(message string) token {
+	return token{
+		typ:    tokenError,
+		start:  0,
+		length: len(message),
+		line:   s.line,
+		column: s.column(s.start),
+		source: &message,
+	}
+}
+
+func (s *scanner) isAtEnd() bool {
+	return s.current >= len(s.source)
+}
+
+type tokenType byte
+
+const (
+	// Single-character tokens.
+	tokenLeftParen tokenType = iota
+	tokenRightParen
+	tokenLeftBrace
+	tokenRightBrace
+	tokenComma
+	tokenDot
+	tokenMinus
+	tokenPlus
+	tokenSemicolon
+	tokenSlash
+	tokenStar
+
+	// One or two character tokens.
+	tokenBang
+	tokenBangEqual
+	tokenEqual
+	tokenEqualEqual
+	tokenGreater
+	tokenGreaterEqual
+	tokenLess
+	tokenLessEqual
+
+	// Literals.
+	tokenIdentifier
+	tokenString
+	tokenNumber
+
+	// Keywords.
+	tokenAnd
+	tokenClass
+	tokenElse
+	tokenFalse
+	tokenFor
+	tokenFun
+	tokenIf
+	tokenNil
+	tokenOr
+	tokenPrint
+	tokenReturn
+	tokenSuper
+	tokenThis
+	tokenTrue
+	tokenVar
+	tokenWhile
+
+	tokenError
+	tokenEOF
+)
@@ -0,0 +1,60 @@
+package lox
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenColumns(t *testing.T) {
+	source := "var a = 1;\n  print \"two\nlines\" + a;\n\t// comment\n!"
+	want := []struct {
+		typ    tokenType
+		line   int
+		column int
+	}{
+		{tokenVar, 1, 1},
+		{tokenIdentifier, 1, 5},
+		{tokenEqual, 1, 7},
+		{tokenNumber, 1, 9},
+		{tokenSemicolon, 1, 10},
+		{tokenPrint, 2, 3},
+		{tokenString, 2, 9}, // N.B. a string which spans lines is at the line and column where it starts
+		{tokenPlus, 3, 8},
+		{tokenIdentifier, 3, 10},
+		{tokenSemicolon, 3, 11},
+		{tokenBang, 5, 1},
+		{tokenEOF, 5, 2},
+	}
+	var s scanner
+	initScanner(&s, source)
+	for i, w := range want {
+		tok := s.scanToken()
+		if tok.typ != w.typ || tok.line != w.line || tok.column != w.column {
+			t.Errorf("token %d = {typ %d, line %d, column %d}, want {typ %d, line %d, column %d}",
+				i, tok.typ, tok.line, tok.column, w.typ, w.line, w.column)
+		}
+	}
+}
+
+func TestUnterminatedStringColumn(t *testing.T) {
+	var s scanner
+	initScanner(&s, "a = \"no\nend")
+	s.scanToken()
+	s.scanToken()
+	if tok := s.scanToken(); tok.typ != tokenError || tok.line != 1 || tok.column != 5 {
+		t.Errorf("unterminated string token = {typ %d, line %d, column %d}, want {typ %d, line 1, column 5}", tok.typ,
+			tok.line, tok.column, tokenError)
+	}
+}
+
+// BenchmarkScanLongLine scans a single line of 40,000 statements, which takes quadratic time if finding the column of
+// each token rescans the line.
+func BenchmarkScanLongLine(b *testing.B) {
+	source := strings.Repeat("print nil; ", 40000)
+	for i := 0; i < b.N; i++ {
+		var s scanner
+		initScanner(&s, source)
+		for s.scanToken().typ != tokenEOF {
+		}
+	}
+}
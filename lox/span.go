@@ -0,0 +1,140 @@
+package lox
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// spanTable records the span of source from which each byte of a chunk was compiled, as a list of runs. N.B. nearly
+// every instruction has a span of its own, so each run is delta encoded against the run before it, as three varints:
+// the distance from its offset, the signed distance from its start, and its length. Most runs fit in three bytes.
+//
+// Every spanCheckpointInterval runs, a checkpoint records the decoded run, so a lookup decodes at most that many runs.
+type spanTable struct {
+	data        []byte
+	checkpoints []spanCheckpoint
+	count       int     // the number of runs in data
+	last        spanRun // the last run in data, which the next run is encoded against
+}
+
+const spanCheckpointInterval = 64
+
+// spanRun records that the bytecode starting at offset, up to the start of the next run, was compiled from span.
+type spanRun struct {
+	offset int
+	span   Span
+}
+
+// spanCheckpoint holds the decoded run at index i*spanCheckpointInterval, for the i-th checkpoint.
+type spanCheckpoint struct {
+	run spanRun
+	pos int // the position in data of the run after it
+}
+
+// add records that the byte at offset was compiled from span. N.B. offsets must be added in increasing order.
+func (t *spanTable) add(offset int, span Span) {
+	if t.count > 0 && t.last.span == span {
+		return
+	}
+	var buf [3 * binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(offset-t.last.offset))
+	n += binary.PutVarint(buf[n:], int64(span.Start-t.last.span.Start))
+	n += binary.PutUvarint(buf[n:], uint64(span.Length))
+	t.data = append(t.data, buf[:n]...)
+
+	t.last = spanRun{offset: offset, span: span}
+	if t.count%spanCheckpointInterval == 0 {
+		t.checkpoints = append(t.checkpoints, spanCheckpoint{run: t.last, pos: len(t.data)})
+	}
+	t.count++
+}
+
+// get returns the span of the byte at offset, or the zero Span if no run covers it.
+func (t *spanTable) get(offset int) Span {
+	cursor, ok := t.seek(offset)
+	if !ok {
+		return Span{}
+	}
+	return cursor.run.span
+}
+
+// truncate discards every run which starts at or after offset.
+func (t *spanTable) truncate(offset int) {
+	cursor, ok := t.seek(offset - 1)
+	if !ok {
+		*t = spanTable{}
+		return
+	}
+	t.data = t.data[:cursor.pos]
+	t.checkpoints = t.checkpoints[:cursor.index/spanCheckpointInterval+1]
+	t.count = cursor.index + 1
+	t.last = cursor.run
+}
+
+// size returns the number of bytes used to store the table.
+func (t *spanTable) size() int {
+	return len(t.data) + len(t.checkpoints)*int(unsafe.Sizeof(spanCheckpoint{}))
+}
+
+// seek returns a cursor at the last run which starts at or before offset, or false if there is none.
+func (t *spanTable) seek(offset int) (spanCursor, bool) {
+	// N.B. binary search for the last checkpoint at or before offset
+	lo, hi := 0, len(t.checkpoints)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if t.checkpoints[mid].run.offset <= offset {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo == 0 {
+		return spanCursor{}, false
+	}
+	checkpoint := t.checkpoints[lo-1]
+	cursor := spanCursor{table: t, run: checkpoint.run, pos: checkpoint.pos, index: (lo - 1) * spanCheckpointInterval}
+	cursor.advance(offset)
+	return cursor, true
+}
+
+// spanCursor reads the runs of a spanTable in order.
+type spanCursor struct {
+	table *spanTable
+	run   spanRun // the current run
+	pos   int     // the position in data of the run after it
+	index int     // the index of the current run
+}
+
+// newSpanCursor returns a cursor for looking up the spans of offsets in increasing order, each in amortized constant
+// time.
+func newSpanCursor(t *spanTable) *spanCursor {
+	return &spanCursor{table: t, index: -1}
+}
+
+// at returns the span of the byte at offset. N.B. offset must not be less than any offset looked up before.
+func (c *spanCursor) at(offset int) Span {
+	c.advance(offset)
+	if c.index < 0 {
+		return Span{}
+	}
+	return c.run.span
+}
+
+// advance moves the cursor forward to the last run which starts at or before offset.
+func (c *spanCursor) advance(offset int) {
+	data := c.table.data
+	for c.pos < len(data) {
+		delta, n := binary.Uvarint(data[c.pos:])
+		if c.run.offset+int(delta) > offset {
+			return
+		}
+		start, m := binary.Varint(data[c.pos+n:])
+		length, k := binary.Uvarint(data[c.pos+n+m:])
+		c.run = spanRun{
+			offset: c.run.offset + int(delta),
+			span:   Span{Start: c.run.span.Start + int(start), Length: int(length)},
+		}
+		c.pos += n + m + k
+		c.index++
+	}
+}
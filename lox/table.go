@@ -0,0 +1,139 @@
+package lox
+
+const tableMaxLoad = 0.75
+
+// table is an open-addressing hash table with linear probing, keyed by interned strings. N.B. a go map would work,
+// but keying on *ObjString lets us reuse the cached hash and compare keys by pointer.
+type table struct {
+	count   int // N.B. includes tombstones
+	entries []entry
+}
+
+type entry struct {
+	key   *ObjString
+	value Value
+}
+
+func (t table) capacity() int {
+	return len(t.entries)
+}
+
+func tableGet(t *table, key *ObjString) (Value, bool) {
+	if t.count == 0 {
+		return NilVal(), false
+	}
+	entry := findEntry(t.entries, key)
+	if entry.key == nil {
+		return NilVal(), false
+	}
+	return entry.value, true
+}
+
+// tableSet adds the given key/value pair to the table, returning true if the key was not already present.
+func tableSet(t *table, key *ObjString, value Value) bool {
+	if float64(t.count+1) > float64(t.capacity())*tableMaxLoad {
+		adjustCapacity(t, growCapacity(t.capacity()))
+	}
+	entry := findEntry(t.entries, key)
+	isNewKey := entry.key == nil
+	if isNewKey && isNil(entry.value) { // N.B. reusing a tombstone does not change the count
+		t.count++
+	}
+	entry.key = key
+	entry.value = value
+	return isNewKey
+}
+
+func tableDelete(t *table, key *ObjString) bool {
+	if t.count == 0 {
+		return false
+	}
+	entry := findEntry(t.entries, key)
+	if entry.key == nil {
+		return false
+	}
+	// place a tombstone in the entry
+	entry.key = nil
+	entry.value = BoolVal(true)
+	return true
+}
+
+func tableAddAll(from, to *table) {
+	for i := range from.entries {
+		entry := &from.entries[i]
+		if entry.key != nil {
+			tableSet(to, entry.key, entry.value)
+		}
+	}
+}
+
+// tableFindString looks up an interned string by its contents rather than by pointer.
+func tableFindString(t *table, chars string, hash uint32) *ObjString {
+	if t.count == 0 {
+		return nil
+	}
+	capacity := uint32(t.capacity())
+	index := hash % capacity
+	for {
+		entry := &t.entries[index]
+		if entry.key == nil {
+			// stop if we find an empty non-tombstone entry
+			if isNil(entry.value) {
+				return nil
+			}
+		} else if entry.key.hash == hash && entry.key.value == chars {
+			return entry.key
+		}
+		index = (index + 1) % capacity
+	}
+}
+
+func findEntry(entries []entry, key *ObjString) *entry {
+	capacity := uint32(len(entries))
+	index := key.hash % capacity
+	var tombstone *entry
+	for {
+		entry := &entries[index]
+		if entry.key == nil {
+			if isNil(entry.value) {
+				// empty entry; reuse the first tombstone we passed, if any
+				if tombstone != nil {
+					return tombstone
+				}
+				return entry
+			} else if tombstone == nil {
+				tombstone = entry
+			}
+		} else if entry.key == key {
+			return entry
+		}
+		index = (index + 1) % capacity
+	}
+}
+
+func adjustCapacity(t *table, capacity int) {
+	entries := make([]entry, capacity)
+	for i := range entries {
+		entries[i].value = NilVal()
+	}
+	// N.B. tombstones are not copied, so the count is rebuilt from scratch.
+	t.count = 0
+	for i := range t.entries {
+		entry := &t.entries[i]
+		if entry.key == nil {
+			continue
+		}
+		dest := findEntry(entries, entry.key)
+		dest.key = entry.key
+		dest.value = entry.value
+		t.count++
+	}
+	t.entries = entries
+}
+
+func growCapacity(capacity int) int {
+	if capacity < 8 {
+		return 8
+	}
+	return capacity * 2
+}
@@ -0,0 +1,202 @@
+package lox
+
+import (
+	"fmt"
+	"testing"
+)
+
+// collidingKeys returns n distinct keys which all hash to the same bucket.
+func collidingKeys(n int) []*ObjString {
+	keys := make([]*ObjString, n)
+	for i := range keys {
+		keys[i] = &ObjString{value: fmt.Sprintf("k%d", i), hash: 3}
+	}
+	return keys
+}
+
+func TestTableSetGet(t *testing.T) {
+	var tbl table
+	keys := make([]*ObjString, 100)
+	for i := range keys {
+		keys[i] = newObjString(fmt.Sprintf("key%d", i))
+		if !tableSet(&tbl, keys[i], NumberVal(float64(i))) {
+			t.Fatalf("tableSet(%s) reported an existing key", keys[i].value)
+		}
+	}
+	if tableSet(&tbl, keys[0], NumberVal(-1)) {
+		t.Errorf("tableSet of an existing key reported a new key")
+	}
+	for i, key := range keys {
+		want := float64(i)
+		if i == 0 {
+			want = -1
+		}
+		value, ok := tableGet(&tbl, key)
+		if !ok || value.AsNumber() != want {
+			t.Errorf("tableGet(%s) = %v, %v; want %v, true", key.value, value, ok, want)
+		}
+	}
+	if _, ok := tableGet(&tbl, newObjString("key0")); ok {
+		t.Errorf("tableGet found a key by value rather than identity")
+	}
+}
+
+func TestTableDeleteLeavesTombstone(t *testing.T) {
+	var tbl table
+	keys := collidingKeys(3)
+	for _, key := range keys {
+		tableSet(&tbl, key, BoolVal(true))
+	}
+	if !tableDelete(&tbl, keys[0]) {
+		t.Fatalf("tableDelete of a present key returned false")
+	}
+	if tableDelete(&tbl, keys[0]) {
+		t.Errorf("tableDelete of a deleted key returned true")
+	}
+	if _, ok := tableGet(&tbl, keys[0]); ok {
+		t.Errorf("tableGet found a deleted key")
+	}
+	// N.B. the later keys were probed past the deleted one, so they are only reachable through its tombstone
+	for _, key := range keys[1:] {
+		if _, ok := tableGet(&tbl, key); !ok {
+			t.Errorf("tableGet(%s) lost a key probed past a tombstone", key.value)
+		}
+	}
+	if tbl.count != 3 {
+		t.Errorf("count = %d after delete, want 3 since tombstones are counted", tbl.count)
+	}
+}
+
+func TestTableReusesTombstone(t *testing.T) {
+	var tbl table
+	keys := collidingKeys(4)
+	for _, key := range keys[:3] {
+		tableSet(&tbl, key, BoolVal(true))
+	}
+	tableDelete(&tbl, keys[1])
+	tombstone := &tbl.entries[(keys[1].hash+1)%uint32(tbl.capacity())]
+
+	if !tableSet(&tbl, keys[3], NumberVal(3)) {
+		t.Fatalf("tableSet of a new key reported an existing key")
+	}
+	if tombstone.key != keys[3] {
+		t.Errorf("new key was not stored in the first tombstone on its probe sequence")
+	}
+	if tbl.count != 3 {
+		t.Errorf("count = %d, want 3 since reusing a tombstone does not add an entry", tbl.count)
+	}
+}
+
+func TestTableGrows(t *testing.T) {
+	var tbl table
+	if tbl.capacity() != 0 {
+		t.Fatalf("empty table has capacity %d", tbl.capacity())
+	}
+	keys := make([]*ObjString, 1000)
+	for i := range keys {
+		keys[i] = newObjString(fmt.Sprintf("key%d", i))
+		tableSet(&tbl, keys[i], NumberVal(float64(i)))
+		if float64(tbl.count) > float64(tbl.capacity())*tableMaxLoad {
+			t.Fatalf("count %d exceeds the max load of capacity %d", tbl.count, tbl.capacity())
+		}
+	}
+	for i, key := range keys {
+		if value, ok := tableGet(&tbl, key); !ok || value.AsNumber() != float64(i) {
+			t.Fatalf("tableGet(%s) = %v, %v after growing", key.value, value, ok)
+		}
+	}
+
+	// N.B. tombstones are dropped when the table grows, so the count is rebuilt from live entries only
+	for _, key := range keys[:500] {
+		tableDelete(&tbl, key)
+	}
+	adjustCapacity(&tbl, growCapacity(tbl.capacity()))
+	if tbl.count != 500 {
+		t.Errorf("count = %d after growing, want 500 live entries", tbl.count)
+	}
+}
+
+func TestTableFindString(t *testing.T) {
+	var tbl table
+	key := newObjString("hello")
+	tableSet(&tbl, key, NilVal())
+	if got := tableFindString(&tbl, "hello", hashString("hello")); got != key {
+		t.Errorf("tableFindString(hello) = %v, want the stored key", got)
+	}
+	if got := tableFindString(&tbl, "world", hashString("world")); got != nil {
+		t.Errorf("tableFindString(world) = %v, want nil", got)
+	}
+	tableDelete(&tbl, key)
+	if got := tableFindString(&tbl, "hello", hashString("hello")); got != nil {
+		t.Errorf("tableFindString found a deleted key")
+	}
+}
+
+func TestTableAddAll(t *testing.T) {
+	var from, to table
+	keys := collidingKeys(5)
+	for i, key := range keys {
+		tableSet(&from, key, NumberVal(float64(i)))
+	}
+	tableDelete(&from, keys[2])
+	tableAddAll(&from, &to)
+	for i, key := range keys {
+		_, ok := tableGet(&to, key)
+		if ok != (i != 2) {
+			t.Errorf("tableGet(%s) = %v after tableAddAll", key.value, ok)
+		}
+	}
+}
+
+// N.B. the benchmarks below mimic the VM's access pattern: a small set of interned names, such as globals or fields,
+// looked up over and over.
+
+func benchmarkKeys() []*ObjString {
+	keys := make([]*ObjString, 64)
+	for i := range keys {
+		keys[i] = newObjString(fmt.Sprintf("variable%d", i))
+	}
+	return keys
+}
+
+func BenchmarkTableGet(b *testing.B) {
+	keys := benchmarkKeys()
+	var tbl table
+	for i, key := range keys {
+		tableSet(&tbl, key, NumberVal(float64(i)))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tableGet(&tbl, keys[i%len(keys)])
+	}
+}
+
+func BenchmarkMapGet(b *testing.B) {
+	keys := benchmarkKeys()
+	m := make(map[string]Value)
+	for i, key := range keys {
+		m[key.value] = NumberVal(float64(i))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = m[keys[i%len(keys)].value]
+	}
+}
+
+func BenchmarkTableSet(b *testing.B) {
+	keys := benchmarkKeys()
+	var tbl table
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tableSet(&tbl, keys[i%len(keys)], NumberVal(float64(i)))
+	}
+}
+
+func BenchmarkMapSet(b *testing.B) {
+	keys := benchmarkKeys()
+	m := make(map[string]Value)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m[keys[i%len(keys)].value] = NumberVal(float64(i))
+	}
+}
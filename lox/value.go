@@ -0,0 +1,27 @@
+package lox
+
+// N.B. the representation of Value is chosen at build time. By default Value is a tagged struct (value_struct.go);
+// building with '-tags nanbox' packs every Value into a single NaN-boxed uint64 instead (value_nanbox.go). Both
+// provide the same constructors (NilVal, BoolVal, NumberVal, ObjVal), the same methods, and the same isX helpers.
+
+type ValueType uint8
+
+const (
+	VAL_BOOL ValueType = iota
+	VAL_NIL
+	VAL_NUMBER
+	VAL_OBJ
+)
+
+type valueArray struct {
+	values []Value
+}
+
+func (a valueArray) count() int {
+	return len(a.values)
+}
+
+func (a *valueArray) writeValue(v Value) error {
+	a.values = append(a.values, v)
+	return nil
+}
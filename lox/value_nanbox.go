@@ -0,0 +1,186 @@
+//go:build nanbox
+// +build nanbox
+
+package lox
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+)
+
+// Value packs every Lox value into the unused bits of a quiet NaN. Numbers are stored as their IEEE-754 bits; any
+// value with all the qnan bits set is something else, distinguished by a tag in the low bits or by the sign bit (objects).
+type Value uint64
+
+const (
+	signBit uint64 = 0x8000000000000000
+	qnan    uint64 = 0x7ffc000000000000
+
+	tagNil   uint64 = 1
+	tagFalse uint64 = 2
+	tagTrue  uint64 = 3
+)
+
+const (
+	nilVal   = Value(qnan | tagNil)
+	falseVal = Value(qnan | tagFalse)
+	trueVal  = Value(qnan | tagTrue)
+)
+
+// NilVal returns the nil value. N.B. this is a function, rather than a constant, to match the default build.
+func NilVal() Value {
+	return nilVal
+}
+
+func NumberVal(n float64) Value {
+	return Value(math.Float64bits(n))
+}
+
+func BoolVal(b bool) Value {
+	if b {
+		return trueVal
+	}
+	return falseVal
+}
+
+// ObjVal boxes an object. N.B. go's garbage collector can't see pointers hidden inside a uint64, so instead of the
+// pointer we store an index into the objects arena, which keeps every boxed object reachable. Objects boxed this way
+// are never collected.
+func ObjVal(obj Obj) Value {
+	return Value(signBit | qnan | objects.indexOf(obj))
+}
+
+func isNumber(v Value) bool {
+	return uint64(v)&qnan != qnan
+}
+
+func isBool(v Value) bool {
+	return v|1 == trueVal // N.B. falseVal and trueVal differ only in the lowest bit
+}
+
+func isNil(v Value) bool {
+	return v == nilVal
+}
+
+func isObj(v Value) bool {
+	return uint64(v)&(qnan|signBit) == qnan|signBit
+}
+
+func (v Value) Type() ValueType {
+	switch {
+	case isNumber(v):
+		return VAL_NUMBER
+	case isNil(v):
+		return VAL_NIL
+	case isBool(v):
+		return VAL_BOOL
+	default:
+		return VAL_OBJ
+	}
+}
+
+func (v Value) AsBoolean() bool {
+	if !isBool(v) {
+		panic("value is not a boolean!")
+	}
+	return v == trueVal
+}
+
+func (v Value) AsNumber() float64 {
+	if !isNumber(v) {
+		panic("value is not a number!")
+	}
+	return math.Float64frombits(uint64(v))
+}
+
+func (v Value) AsObj() Obj {
+	if !isObj(v) {
+		panic("value is not an object!")
+	}
+	return objects.get(uint64(v) &^ (signBit | qnan))
+}
+
+// Boolean returns the value as a bool, and whether it is a boolean. N.B. unlike AsBoolean, it never panics.
+func (v Value) Boolean() (bool, bool) {
+	return v == trueVal, isBool(v)
+}
+
+// Number returns the value as a float64, and whether it is a number.
+func (v Value) Number() (float64, bool) {
+	if !isNumber(v) {
+		return 0, false
+	}
+	return math.Float64frombits(uint64(v)), true
+}
+
+// Object returns the value as an Obj, and whether it is an object.
+func (v Value) Object() (Obj, bool) {
+	if !isObj(v) {
+		return nil, false
+	}
+	return v.AsObj(), true
+}
+
+// String returns the value formatted as the print statement would write it.
+func (v Value) String() string {
+	var sb strings.Builder
+	v.Fprint(&sb)
+	return sb.String()
+}
+
+// Fprint writes the value to w, formatted as the print statement would write it.
+func (v Value) Fprint(w io.Writer) {
+	switch v.Type() {
+	case VAL_BOOL:
+		fmt.Fprintf(w, "%t", v.AsBoolean())
+	case VAL_NIL:
+		fmt.Fprint(w, "nil")
+	case VAL_NUMBER:
+		fmt.Fprintf(w, "%g", v.AsNumber())
+	case VAL_OBJ:
+		v.AsObj().Fprint(w)
+	}
+}
+
+// objectArena maps between objects and the indices stored in NaN-boxed values. Each object is given exactly one
+// index, so two boxes of the same object are bitwise equal.
+//
+// N.B. go's garbage collector can't see pointers hidden in a uint64, so the arena keeps every object that was ever
+// boxed alive for the life of the process. It is shared by every VM, since ObjVal has no VM to belong to, and boxing
+// or unboxing an object takes its lock. The nanbox build is therefore unsuitable for embedding in long-running or
+// highly concurrent processes, and is kept only as an experiment; see the README for how it compares to the default.
+type objectArena struct {
+	mu      sync.RWMutex
+	objs    []Obj
+	indices map[Obj]uint64
+}
+
+var objects = objectArena{indices: make(map[Obj]uint64)}
+
+func (a *objectArena) indexOf(obj Obj) uint64 {
+	a.mu.RLock()
+	index, ok := a.indices[obj]
+	a.mu.RUnlock()
+	if ok {
+		return index
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if index, ok := a.indices[obj]; ok {
+		return index
+	}
+	index = uint64(len(a.objs))
+	a.objs = append(a.objs, obj)
+	a.indices[obj] = index
+	return index
+}
+
+func (a *objectArena) get(index uint64) Obj {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.objs[index]
+}
@@ -0,0 +1,119 @@
+//go:build !nanbox
+// +build !nanbox
+
+package lox
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Value is a small tagged union. N.B. storing a float64 in an interface heap-allocates, so unlike the book's union the
+// payloads get separate fields: num holds numbers and booleans, obj holds objects.
+type Value struct {
+	typ ValueType
+	num float64
+	obj Obj
+}
+
+// NilVal returns the nil value. N.B. this is a function, rather than a variable, so it can't be reassigned.
+func NilVal() Value {
+	return Value{typ: VAL_NIL}
+}
+
+func NumberVal(n float64) Value {
+	return Value{typ: VAL_NUMBER, num: n}
+}
+
+func BoolVal(b bool) Value {
+	if b {
+		return Value{typ: VAL_BOOL, num: 1}
+	}
+	return Value{typ: VAL_BOOL}
+}
+
+func ObjVal(obj Obj) Value {
+	return Value{typ: VAL_OBJ, obj: obj}
+}
+
+func isNumber(v Value) bool {
+	return v.typ == VAL_NUMBER
+}
+func isBool(v Value) bool {
+	return v.typ == VAL_BOOL
+}
+func isNil(v Value) bool {
+	return v.typ == VAL_NIL
+}
+
+func isObj(v Value) bool {
+	return v.typ == VAL_OBJ
+}
+
+func (v Value) Type() ValueType {
+	return v.typ
+}
+
+func (v Value) AsBoolean() bool {
+	if v.typ != VAL_BOOL {
+		panic("value is not a boolean!") // N.B. panicking is one choice... returning the zero value is another...
+	}
+	return v.num != 0
+}
+
+func (v Value) AsNumber() float64 {
+	if v.typ != VAL_NUMBER {
+		panic("value is not a number!")
+	}
+	return v.num
+}
+
+func (v Value) AsObj() Obj {
+	if v.typ != VAL_OBJ {
+		panic("value is not an object!")
+	}
+	return v.obj
+}
+
+// Boolean returns the value as a bool, and whether it is a boolean. N.B. unlike AsBoolean, it never panics.
+func (v Value) Boolean() (bool, bool) {
+	if v.typ != VAL_BOOL {
+		return false, false
+	}
+	return v.num != 0, true
+}
+
+// Number returns the value as a float64, and whether it is a number.
+func (v Value) Number() (float64, bool) {
+	if v.typ != VAL_NUMBER {
+		return 0, false
+	}
+	return v.num, true
+}
+
+// Object returns the value as an Obj, and whether it is an object.
+func (v Value) Object() (Obj, bool) {
+	return v.obj, v.typ == VAL_OBJ
+}
+
+// String returns the value formatted as the print statement would write it.
+func (v Value) String() string {
+	var sb strings.Builder
+	v.Fprint(&sb)
+	return sb.String()
+}
+
+// Fprint writes the value to w, formatted as the print statement would write it.
+func (v Value) Fprint(w io.Writer) {
+	switch v.typ {
+	case VAL_BOOL:
+		fmt.Fprintf(w, "%t", v.AsBoolean())
+	case VAL_NIL:
+		fmt.Fprint(w, "nil")
+	case VAL_NUMBER:
+		fmt.Fprintf(w, "%g", v.num)
+	case VAL_OBJ:
+		v.obj.Fprint(w)
+	}
+}
@@ -0,0 +1,96 @@
+package lox
+
+import (
+	"fmt"
+	"testing"
+)
+
+// N.B. run these with and without -tags nanbox to compare the two Value representations.
+
+const arithmeticScript = `
+var sum = 0;
+for (var i = 0; i < 10000; i = i + 1) {
+  sum = sum + i * 2 - i / 3;
+}
+`
+
+const fibScript = `
+fun fib(n) { if (n < 2) return n; return fib(n - 2) + fib(n - 1); }
+fib(20);
+`
+
+func BenchmarkArithmeticScript(b *testing.B) {
+	benchmarkVM(b, NewVM(), arithmeticScript)
+}
+
+func BenchmarkFibScript(b *testing.B) {
+	benchmarkVM(b, NewVM(), fibScript)
+}
+
+// arithmeticLoop runs iterations of a loop doing nothing but arithmetic and comparisons on locals.
+const arithmeticLoop = `
+{
+  var x = 1;
+  for (var i = 0; i < %d; i = i + 1) {
+    x = x * 1.5 + i - i / 2;
+    x = -x;
+  }
+}
+`
+
+// BenchmarkArithmeticOpAllocs reports allocations per loop iteration, each of which runs six arithmetic opcodes and a
+// comparison. The fixed cost of running the chunk is amortized over b.N iterations, so it should report 0 allocs/op.
+func BenchmarkArithmeticOpAllocs(b *testing.B) {
+	chunk, err := Compile(fmt.Sprintf(arithmeticLoop, b.N))
+	if err != nil {
+		b.Fatal(err)
+	}
+	vm := NewVM()
+	b.ReportAllocs()
+	b.ResetTimer()
+	if err := vm.Run(chunk); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func TestArithmeticDoesNotAllocate(t *testing.T) {
+	allocs := func(iterations int) float64 {
+		chunk, err := Compile(fmt.Sprintf(arithmeticLoop, iterations))
+		if err != nil {
+			t.Fatal(err)
+		}
+		vm := NewVM()
+		return testing.AllocsPerRun(10, func() {
+			if err := vm.Run(chunk); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	if short, long := allocs(10), allocs(10000); short != long {
+		t.Errorf("running 10 iterations allocated %v times, but 10000 allocated %v times", short, long)
+	}
+}
+
+func TestAccessors(t *testing.T) {
+	str := ObjVal(newObjString("s"))
+	for _, v := range []Value{NilVal(), BoolVal(false), NumberVal(0), NumberVal(5), str} {
+		if b, ok := v.Boolean(); ok != isBool(v) || (!ok && b) {
+			t.Errorf("%v.Boolean() = %v, %v", v, b, ok)
+		}
+		if n, ok := v.Number(); ok != isNumber(v) || (!ok && n != 0) {
+			t.Errorf("%v.Number() = %v, %v", v, n, ok)
+		}
+		if o, ok := v.Object(); ok != isObj(v) || (!ok && o != nil) {
+			t.Errorf("%v.Object() = %v, %v", v, o, ok)
+		}
+	}
+	if b, ok := BoolVal(true).Boolean(); !b || !ok {
+		t.Errorf("BoolVal(true).Boolean() = %v, %v", b, ok)
+	}
+	if n, ok := NumberVal(5).Number(); n != 5 || !ok {
+		t.Errorf("NumberVal(5).Number() = %v, %v", n, ok)
+	}
+	if o, ok := str.Object(); o == nil || !ok {
+		t.Errorf("ObjVal(s).Object() = %v, %v", o, ok)
+	}
+}
@@ -0,0 +1,663 @@
+package lox
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime/debug"
+	"strings"
+)
+
+const framesMax = 64
+const stackMax = framesMax * uint8Count
+
+type callFrame struct {
+	// N.B. ip and slots are indices into the function's code and the VM's stack, respectively.
+	closure *ObjClosure
+	ip      int
+	slots   int
+}
+
+type VM struct {
+	// N.B. uses slice indices instead 'real C-pointers', to avoid the unsafe package.
+	frames       [framesMax]callFrame
+	frameCount   int
+	stack        [stackMax]Value
+	stackTop     int
+	globals      table
+	strings      table
+	initString   *ObjString
+	openUpvalues *ObjUpvalue // N.B. sorted by stack slot, topmost first
+	stdin        *bufio.Reader
+	stdout       io.Writer
+	stderr       io.Writer
+	trace        io.Writer
+	err          *RuntimeError // the error raised by the last call to run, if any
+
+	traceExecution bool
+	printCode      bool
+}
+
+// Option configures a VM created by NewVM.
+type Option func(*VM)
+
+// WithInput sets the reader from which the input() native reads lines. By default there is no input.
+func WithInput(r io.Reader) Option {
+	return func(v *VM) {
+		if br, ok := r.(*bufio.Reader); ok {
+			v.stdin = br
+		} else {
+			v.stdin = bufio.NewReader(r)
+		}
+	}
+}
+
+// WithStdout sets the writer used by the print statement. By default output is discarded.
+func WithStdout(w io.Writer) Option {
+	return func(v *VM) {
+		v.stdout = w
+	}
+}
+
+// WithStderr sets the writer to which compile and runtime errors are reported, in addition to being returned. By
+// default they are only returned.
+func WithStderr(w io.Writer) Option {
+	return func(v *VM) {
+		v.stderr = w
+	}
+}
+
+// WithTrace sets the writer used for disassembly and execution traces. By default they are discarded.
+func WithTrace(w io.Writer) Option {
+	return func(v *VM) {
+		v.trace = w
+	}
+}
+
+// WithTraceExecution makes the VM write the stack and the disassembly of each instruction to the trace writer before
+// executing it. N.B. this replaces the book's DEBUG_TRACE_EXECUTION.
+func WithTraceExecution() Option {
+	return func(v *VM) {
+		v.traceExecution = true
+	}
+}
+
+// WithPrintCode makes the VM write the disassembly of each function it compiles to the trace writer. N.B. this
+// replaces the book's DEBUG_PRINT_CODE.
+func WithPrintCode() Option {
+	return func(v *VM) {
+		v.printCode = true
+	}
+}
+
+// NewVM creates a VM. N.B. a VM never touches the process's standard streams unless it is given them as options.
+func NewVM(opts ...Option) *VM {
+	v := &VM{
+		stdin:  bufio.NewReader(strings.NewReader("")),
+		stdout: ioutil.Discard,
+		stderr: ioutil.Discard,
+		trace:  ioutil.Discard,
+	}
+	v.resetStack()
+	v.initString = v.copyString("init")
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	v.DefineNative("clock", 0, clockNative)
+	v.DefineNative("input", 0, v.inputNative)
+	v.DefineNative("typeOf", 1, v.typeOfNative)
+	return v
+}
+
+// DefineNative binds a go function to a global variable with the given name.
+func (v *VM) DefineNative(name string, arity int, function NativeFn) {
+	nameString := v.copyString(name)
+	tableSet(&v.globals, nameString, ObjVal(newObjNative(nameString, arity, function)))
+}
+
+// String returns s as a Lox string belonging to this VM. N.B. strings are compared by identity, so a native which
+// returns a string must create it here, where it is interned, for it to equal the same string made any other way.
+func (v *VM) String(s string) Value {
+	return ObjVal(v.copyString(s))
+}
+
+type interpretResult byte
+
+const (
+	interpretOK interpretResult = iota
+	interpretCompileError
+	interpretRuntimeError
+)
+
+// Interpret compiles and runs source. Globals defined by earlier calls remain visible.
+func (v *VM) Interpret(source string) error {
+	return v.InterpretFile("", source)
+}
+
+// InterpretFile is like Interpret, but names the file source was read from in any errors.
+func (v *VM) InterpretFile(file, source string) error {
+	var codeWriter io.Writer
+	if v.printCode {
+		codeWriter = v.trace
+	}
+	function, err := compile(file, source, codeWriter)
+	if err != nil {
+		fmt.Fprintln(v.stderr, err)
+		return err
+	}
+	return v.Run(&function.chunk)
+}
+
+// Run runs a chunk returned by Compile as a top-level script. If the script fails, the error is a *RuntimeError and
+// the VM is reset so that it can run another chunk.
+func (v *VM) Run(chunk *Chunk) error {
+	function := newObjFunction()
+	function.chunk = *chunk
+	if v.runFunction(v.load(function)) != interpretOK {
+		err := v.err
+		v.err = nil
+		fmt.Fprintln(v.stderr, err)
+		return err
+	}
+	return nil
+}
+
+// load returns a copy of function whose string constants are interned in this VM, loading nested functions the same
+// way. N.B. the compiled function is never modified, so one chunk can be run by many VMs.
+func (v *VM) load(function *ObjFunction) *ObjFunction {
+	loaded := *function
+	if function.name != nil {
+		loaded.name = v.copyString(function.name.value)
+	}
+	loaded.chunk.constants.values = make([]Value, len(function.chunk.constants.values))
+	for i, constant := range function.chunk.constants.values {
+		if isString(constant) {
+			constant = ObjVal(v.copyString(asString(constant).value))
+		} else if isFunction(constant) {
+			constant = ObjVal(v.load(asFunction(constant)))
+		}
+		loaded.chunk.constants.values[i] = constant
+	}
+	return &loaded
+}
+
+func (v *VM) runFunction(function *ObjFunction) interpretResult {
+	v.push(ObjVal(function))
+	closure := newObjClosure(function)
+	v.pop()
+	v.push(ObjVal(closure))
+	v.call(closure, 0)
+	return v.run()
+}
+
+func add(a, b float64) Value          { return NumberVal(a + b) }
+func subtract(a, b float64) Value     { return NumberVal(a - b) }
+func multiply(a, b float64) Value     { return NumberVal(a * b) }
+func divide(a, b float64) Value       { return NumberVal(a / b) }
+func greater(a, b float64) Value      { return BoolVal(a > b) }
+func less(a, b float64) Value         { return BoolVal(a < b) }
+func greaterEqual(a, b float64) Value { return BoolVal(a >= b) }
+func lessEqual(a, b float64) Value    { return BoolVal(a <= b) }
+
+func (v *VM) run() (result interpretResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			v.internalError(r, debug.Stack())
+			result = interpretRuntimeError
+		}
+	}()
+
+	frame := &v.frames[v.frameCount-1]
+	traceExecution := v.traceExecution // N.B. hoisted so that the check costs a single predictable branch
+	for {
+		if traceExecution {
+			fmt.Fprintf(v.trace, "          ")
+			for i := 0; i < v.stackTop; i++ {
+				fmt.Fprintf(v.trace, "[ ")
+				v.stack[i].Fprint(v.trace)
+				fmt.Fprintf(v.trace, " ]")
+			}
+			fmt.Fprintln(v.trace)
+			disassembleInstruction(v.trace, &frame.closure.function.chunk, frame.ip)
+		}
+		instruction := frame.readByte()
+		switch instruction {
+		case OP_CONSTANT, OP_CONSTANT_LONG:
+			constant := frame.readConstant(instruction)
+			v.push(constant)
+		case OP_NEGATE:
+			if !isNumber(v.peek(0)) {
+				v.runtimeError("Operand must be a number.")
+				return interpretRuntimeError
+			}
+			v.push(NumberVal(-v.pop().AsNumber()))
+		case OP_EQUAL:
+			b, a := v.pop(), v.pop()
+			v.push(BoolVal(valuesEqual(a, b)))
+		case OP_GREATER:
+			if !v.binaryOp(greater) {
+				return interpretRuntimeError
+			}
+		case OP_LESS:
+			if !v.binaryOp(less) {
+				return interpretRuntimeError
+			}
+		case OP_NOT_EQUAL:
+			b, a := v.pop(), v.pop()
+			v.push(BoolVal(!valuesEqual(a, b)))
+		case OP_GREATER_EQUAL:
+			if !v.binaryOp(greaterEqual) {
+				return interpretRuntimeError
+			}
+		case OP_LESS_EQUAL:
+			if !v.binaryOp(lessEqual) {
+				return interpretRuntimeError
+			}
+		case OP_ADD:
+			if isString(v.peek(0)) && isString(v.peek(1)) {
+				v.concatenate()
+			} else if isNumber(v.peek(0)) && isNumber(v.peek(1)) {
+				if !v.binaryOp(add) {
+					return interpretRuntimeError
+				}
+			} else {
+				v.runtimeError("Operands must be two numbers or two strings.")
+				return interpretRuntimeError
+			}
+		case OP_SUBTRACT:
+			if !v.binaryOp(subtract) {
+				return interpretRuntimeError
+			}
+		case OP_MULTIPLY:
+			if !v.binaryOp(multiply) {
+				return interpretRuntimeError
+			}
+		case OP_DIVIDE:
+			if !v.binaryOp(divide) {
+				return interpretRuntimeError
+			}
+		case OP_NOT:
+			v.push(BoolVal(isFalsey(v.pop())))
+		case OP_NIL:
+			v.push(NilVal())
+		case OP_TRUE:
+			v.push(BoolVal(true))
+		case OP_FALSE:
+			v.push(BoolVal(false))
+		case OP_PRINT:
+			v.pop().Fprint(v.stdout)
+			fmt.Fprintln(v.stdout)
+		case OP_POP:
+			v.pop()
+		case OP_DEFINE_GLOBAL, OP_DEFINE_GLOBAL_LONG:
+			name := frame.readString(instruction)
+			tableSet(&v.globals, name, v.peek(0))
+			v.pop()
+		case OP_GET_GLOBAL, OP_GET_GLOBAL_LONG:
+			name := frame.readString(instruction)
+			value, ok := tableGet(&v.globals, name)
+			if !ok {
+				v.runtimeError("Undefined variable '%s'.", name.value)
+				return interpretRuntimeError
+			}
+			v.push(value)
+		case OP_SET_GLOBAL, OP_SET_GLOBAL_LONG:
+			name := frame.readString(instruction)
+			if tableSet(&v.globals, name, v.peek(0)) {
+				// N.B. assignment never creates a global, so undo the implicit declaration
+				tableDelete(&v.globals, name)
+				v.runtimeError("Undefined variable '%s'.", name.value)
+				return interpretRuntimeError
+			}
+		case OP_GET_LOCAL:
+			slot := frame.readByte()
+			v.push(v.stack[frame.slots+int(slot)])
+		case OP_SET_LOCAL:
+			slot := frame.readByte()
+			v.stack[frame.slots+int(slot)] = v.peek(0)
+		case OP_JUMP:
+			offset := frame.readShort()
+			frame.ip += int(offset)
+		case OP_JUMP_IF_FALSE:
+			offset := frame.readShort()
+			if isFalsey(v.peek(0)) {
+				frame.ip += int(offset)
+			}
+		case OP_LOOP:
+			offset := frame.readShort()
+			frame.ip -= int(offset)
+		case OP_GET_PROPERTY, OP_GET_PROPERTY_LONG:
+			if !isInstance(v.peek(0)) {
+				v.runtimeError("Only instances have properties.")
+				return interpretRuntimeError
+			}
+			instance := asInstance(v.peek(0))
+			name := frame.readString(instruction)
+
+			if value, ok := tableGet(&instance.fields, name); ok {
+				v.pop() // instance
+				v.push(value)
+				break
+			}
+			if !v.bindMethod(instance.klass, name) {
+				return interpretRuntimeError
+			}
+		case OP_SET_PROPERTY, OP_SET_PROPERTY_LONG:
+			if !isInstance(v.peek(1)) {
+				v.runtimeError("Only instances have fields.")
+				return interpretRuntimeError
+			}
+			instance := asInstance(v.peek(1))
+			tableSet(&instance.fields, frame.readString(instruction), v.peek(0))
+			value := v.pop()
+			v.pop() // instance
+			v.push(value)
+		case OP_GET_UPVALUE:
+			slot := frame.readByte()
+			v.push(*frame.closure.upvalues[slot].location)
+		case OP_SET_UPVALUE:
+			slot := frame.readByte()
+			*frame.closure.upvalues[slot].location = v.peek(0)
+		case OP_CALL:
+			argCount := int(frame.readByte())
+			if !v.callValue(v.peek(argCount), argCount) {
+				return interpretRuntimeError
+			}
+			frame = &v.frames[v.frameCount-1]
+		case OP_CLOSURE, OP_CLOSURE_LONG:
+			function := asFunction(frame.readConstant(instruction))
+			closure := newObjClosure(function)
+			v.push(ObjVal(closure))
+			for i := range closure.upvalues {
+				isLocal := frame.readByte()
+				index := int(frame.readByte())
+				if isLocal == 1 {
+					closure.upvalues[i] = v.captureUpvalue(frame.slots + index)
+				} else {
+					closure.upvalues[i] = frame.closure.upvalues[index]
+				}
+			}
+		case OP_CLOSE_UPVALUE:
+			v.closeUpvalues(v.stackTop - 1)
+			v.pop()
+		case OP_CLASS, OP_CLASS_LONG:
+			v.push(ObjVal(newObjClass(frame.readString(instruction))))
+		case OP_INHERIT:
+			superclass := v.peek(1)
+			if !isClass(superclass) {
+				v.runtimeError("Superclass must be a class.")
+				return interpretRuntimeError
+			}
+			subclass := asClass(v.peek(0))
+			tableAddAll(&asClass(superclass).methods, &subclass.methods)
+			v.pop() // subclass
+		case OP_GET_SUPER, OP_GET_SUPER_LONG:
+			name := frame.readString(instruction)
+			superclass := asClass(v.pop())
+			if !v.bindMethod(superclass, name) {
+				return interpretRuntimeError
+			}
+		case OP_METHOD, OP_METHOD_LONG:
+			v.defineMethod(frame.readString(instruction))
+		case OP_RETURN:
+			result := v.pop()
+			v.closeUpvalues(frame.slots)
+			v.frameCount--
+			if v.frameCount == 0 {
+				v.pop()
+				return interpretOK
+			}
+			v.stackTop = frame.slots
+			v.push(result)
+			frame = &v.frames[v.frameCount-1]
+		}
+	}
+}
+
+func (v *VM) callValue(callee Value, argCount int) bool {
+	if isObj(callee) {
+		switch objType(callee) {
+		case OBJ_BOUND_METHOD:
+			bound := asBoundMethod(callee)
+			v.stack[v.stackTop-argCount-1] = bound.receiver
+			return v.call(bound.method, argCount)
+		case OBJ_CLASS:
+			klass := asClass(callee)
+			v.stack[v.stackTop-argCount-1] = ObjVal(newObjInstance(klass))
+			if initializer, ok := tableGet(&klass.methods, v.initString); ok {
+				return v.call(asClosure(initializer), argCount)
+			} else if argCount != 0 {
+				v.runtimeError("Expected 0 arguments but got %d.", argCount)
+				return false
+			}
+			return true
+		case OBJ_CLOSURE:
+			return v.call(asClosure(callee), argCount)
+		case OBJ_NATIVE:
+			return v.callNative(asNative(callee), argCount)
+		}
+	}
+	v.runtimeError("Can only call functions and classes.")
+	return false
+}
+
+func (v *VM) call(closure *ObjClosure, argCount int) bool {
+	if argCount != closure.function.arity {
+		v.runtimeError("Expected %d arguments but got %d.", closure.function.arity, argCount)
+		return false
+	}
+	if v.frameCount == framesMax {
+		v.runtimeError("Stack overflow.")
+		return false
+	}
+	frame := &v.frames[v.frameCount]
+	v.frameCount++
+	frame.closure = closure
+	frame.ip = 0
+	frame.slots = v.stackTop - argCount - 1
+	return true
+}
+
+func (v *VM) callNative(native *ObjNative, argCount int) bool {
+	if argCount != native.arity {
+		v.runtimeError("Expected %d arguments but got %d.", native.arity, argCount)
+		return false
+	}
+	result, err := native.function(v.stack[v.stackTop-argCount : v.stackTop])
+	if err != nil {
+		v.runtimeError("%s", err.Error())
+		return false
+	}
+	v.stackTop -= argCount + 1
+	v.push(result)
+	return true
+}
+
+// bindMethod replaces the instance on top of the stack with its class's method of the given name, bound to it.
+func (v *VM) bindMethod(klass *ObjClass, name *ObjString) bool {
+	method, ok := tableGet(&klass.methods, name)
+	if !ok {
+		v.runtimeError("Undefined property '%s'.", name.value)
+		return false
+	}
+	bound := newObjBoundMethod(v.peek(0), asClosure(method))
+	v.pop()
+	v.push(ObjVal(bound))
+	return true
+}
+
+func (v *VM) defineMethod(name *ObjString) {
+	method := v.peek(0)
+	klass := asClass(v.peek(1))
+	tableSet(&klass.methods, name, method)
+	v.pop()
+}
+
+// captureUpvalue returns the open upvalue for the given stack slot, creating it if no closure has captured the slot.
+func (v *VM) captureUpvalue(slot int) *ObjUpvalue {
+	var prevUpvalue *ObjUpvalue
+	upvalue := v.openUpvalues
+	for upvalue != nil && upvalue.slot > slot {
+		prevUpvalue = upvalue
+		upvalue = upvalue.next
+	}
+	if upvalue != nil && upvalue.slot == slot {
+		return upvalue
+	}
+
+	createdUpvalue := newObjUpvalue(&v.stack[slot], slot)
+	createdUpvalue.next = upvalue
+	if prevUpvalue == nil {
+		v.openUpvalues = createdUpvalue
+	} else {
+		prevUpvalue.next = createdUpvalue
+	}
+	return createdUpvalue
+}
+
+// closeUpvalues closes every open upvalue which refers to the given stack slot or any slot above it.
+func (v *VM) closeUpvalues(last int) {
+	for v.openUpvalues != nil && v.openUpvalues.slot >= last {
+		upvalue := v.openUpvalues
+		upvalue.closed = *upvalue.location
+		upvalue.location = &upvalue.closed
+		v.openUpvalues = upvalue.next
+	}
+}
+
+func valuesEqual(a, b Value) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a.Type() {
+	case VAL_BOOL:
+		return a.AsBoolean() == b.AsBoolean()
+	case VAL_NIL:
+		return true
+	case VAL_NUMBER:
+		return a.AsNumber() == b.AsNumber()
+	case VAL_OBJ:
+		return a.AsObj() == b.AsObj() // N.B. all strings are interned, so identity is enough.
+	}
+	return false
+}
+
+func isFalsey(value Value) bool {
+	return isNil(value) || (isBool(value) && !value.AsBoolean())
+}
+
+func (v *VM) concatenate() {
+	b, a := asString(v.pop()), asString(v.pop())
+	v.push(ObjVal(v.copyString(a.value + b.value)))
+}
+
+func (v *VM) binaryOp(op func(float64, float64) Value) bool {
+	if !isNumber(v.peek(0)) || !isNumber(v.peek(1)) {
+		v.runtimeError("Operands must be numbers.")
+		return false
+	}
+	b, a := v.pop().AsNumber(), v.pop().AsNumber()
+	v.push(op(a, b))
+	return true
+}
+
+func (f *callFrame) readByte() byte {
+	result := f.closure.function.chunk.Code[f.ip]
+	f.ip++
+	return result
+}
+
+func (f *callFrame) readShort() uint16 {
+	f.ip += 2
+	code := f.closure.function.chunk.Code
+	return uint16(code[f.ip-2])<<8 | uint16(code[f.ip-1])
+}
+
+// readConstant reads the constant index operand of instruction, which is 24 bits wide for the _LONG variants.
+func (f *callFrame) readConstant(instruction byte) Value {
+	if isLongConstantOp(instruction) {
+		f.ip += 3
+		return f.closure.function.chunk.constants.values[readUint24(f.closure.function.chunk.Code, f.ip-3)]
+	}
+	return f.closure.function.chunk.constants.values[f.readByte()]
+}
+
+func (f *callFrame) readString(instruction byte) *ObjString {
+	return asString(f.readConstant(instruction))
+}
+
+func (v *VM) resetStack() {
+	v.stackTop = 0
+	v.frameCount = 0
+	v.openUpvalues = nil
+}
+
+func (v *VM) peek(distance int) Value {
+	return v.stack[v.stackTop-distance-1]
+}
+
+func (v *VM) push(value Value) {
+	v.stack[v.stackTop] = value
+	v.stackTop++
+}
+
+func (v *VM) pop() Value {
+	v.stackTop--
+	return v.stack[v.stackTop]
+}
+
+// runtimeError records a RuntimeError for the current instruction, including a trace of the call stack, and resets the
+// stack.
+func (v *VM) runtimeError(format string, a ...interface{}) {
+	err := &RuntimeError{Message: fmt.Sprintf(format, a...)}
+
+	// N.B. errors are raised after an instruction's operands have been read, so the instruction ends at ip.
+	top := &v.frames[v.frameCount-1]
+	err.Offset = instructionAt(&top.closure.function.chunk, top.ip)
+	err.Op = top.closure.function.chunk.Code[err.Offset]
+	err.Snippet = top.closure.function.chunk.snippet(err.Offset)
+	err.Frames = v.stackTrace()
+
+	v.err = err
+	v.resetStack()
+}
+
+// internalError records a go panic raised while running a script as a RuntimeError, so that a buggy script (or VM) can't
+// take down the host process. N.B. the failing instruction can't be decoded reliably here, so Offset is the offset of
+// the last byte read.
+func (v *VM) internalError(cause interface{}, goStack []byte) {
+	err := &RuntimeError{GoStack: goStack}
+	if v.frameCount > 0 {
+		top := &v.frames[v.frameCount-1]
+		code := top.closure.function.chunk.Code
+		err.Offset = top.ip - 1
+		if err.Offset >= 0 && err.Offset < len(code) {
+			err.Op = code[err.Offset]
+		}
+		err.Snippet = top.closure.function.chunk.snippet(err.Offset)
+	}
+	err.Message = fmt.Sprintf("Internal error at ip %d: %v", err.Offset, cause)
+	err.Frames = v.stackTrace()
+
+	v.err = err
+	v.resetStack()
+}
+
+func (v *VM) stackTrace() []StackFrame {
+	var frames []StackFrame
+	for i := v.frameCount - 1; i >= 0; i-- {
+		frame := &v.frames[i]
+		function := frame.closure.function
+		stackFrame := StackFrame{File: function.chunk.file, Line: function.chunk.GetLine(frame.ip - 1)}
+		if snippet := function.chunk.snippet(frame.ip - 1); snippet != nil {
+			stackFrame.Column = snippet.Column
+		}
+		if function.name != nil {
+			stackFrame.Function = function.name.value
+		}
+		frames = append(frames, stackFrame)
+	}
+	return frames
+}